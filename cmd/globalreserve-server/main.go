@@ -0,0 +1,85 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// globalreserve-server runs GloalReserve without a scheduler, every scheduler reserves through its
+// REST API, including the default scheduler with the plugin in remote mode.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"kube-globalreserve/pkg/reserve"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog"
+)
+
+func main() {
+	var kubeconfig, master, configFile string
+	flag.StringVar(&kubeconfig, "kubeconfig", "", "path to the kubeconfig file, empty means the in-cluster configuration")
+	flag.StringVar(&master, "master", "", "address of the Kubernetes API server, overrides the kubeconfig")
+	flag.StringVar(&configFile, "config", "", "path to the GRConf file in YAML or JSON")
+	klog.InitFlags(nil)
+	flag.Parse()
+	defer klog.Flush()
+
+	if err := run(kubeconfig, master, configFile); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+		klog.Flush()
+		os.Exit(1)
+	}
+}
+
+func run(kubeconfig, master, configFile string) error {
+	conf, err := reserve.LoadGRConf(configFile)
+	if err != nil {
+		return err
+	}
+	if len(conf.RemoteURL) > 0 || len(conf.RemoteURLs) > 0 {
+		return fmt.Errorf("remoteURL can not be used by globalreserve-server")
+	}
+
+	restConfig, err := clientcmd.BuildConfigFromFlags(master, kubeconfig)
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+
+	er, err := reserve.NewEmbeddedReserveForClient(client, conf, true)
+	if err != nil {
+		return err
+	}
+	if err := er.Start(); err != nil {
+		return err
+	}
+	klog.Infof("globalreserve-server is listening %s", er.Addr())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	klog.Infof("globalreserve-server is shutting down")
+	er.Stop()
+
+	return nil
+}
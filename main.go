@@ -17,6 +17,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"kube-globalreserve/pkg/reserve"
 	"math/rand"
@@ -37,7 +38,22 @@ func main() {
 	logs.InitLogs()
 	defer logs.FlushLogs()
 
-	if err := command.Execute(); err != nil {
+	// the scheduler command does not return on SIGTERM, drain the requests before the process exits
+	stop := reserve.ShutdownLocalReservesOnSignal(10*time.Second, func() {
+		logs.FlushLogs()
+		os.Exit(0)
+	})
+	err := command.Execute()
+	stop()
+
+	// drain the requests of the other schedulers before exiting
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if shutdownErr := reserve.ShutdownLocalReserves(ctx); shutdownErr != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v\n", shutdownErr)
+	}
+
+	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,205 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// ExpectedEndAnnotation is the pod annotation estimating when the pod ends, in RFC3339 format
+const ExpectedEndAnnotation string = "globalreserve.ibm.com/expected-end"
+
+// NodeAvailability node backfill query http return data struct
+type NodeAvailability struct {
+	Name      string
+	Until     time.Time
+	Available v1.ResourceList // free from now until Until for the pods not using the emergency resources
+}
+
+// GetPodExpectedEnd returns when the pod is expected to end by ExpectedEndAnnotation or
+// activeDeadlineSeconds, zero if the pod does not estimate it
+func GetPodExpectedEnd(pod *v1.Pod, now time.Time) time.Time {
+	if value, ok := pod.Annotations[ExpectedEndAnnotation]; ok {
+		end, err := time.Parse(time.RFC3339, value)
+		if err == nil {
+			return end
+		}
+		klog.Warningf("Pod %s has invalid %s %q: %v", PodKey(pod), ExpectedEndAnnotation, value, err)
+	}
+
+	if pod.Spec.ActiveDeadlineSeconds != nil {
+		start := now
+		if pod.Status.StartTime != nil {
+			start = pod.Status.StartTime.Time
+		}
+		return start.Add(time.Duration(*pod.Spec.ActiveDeadlineSeconds) * time.Second)
+	}
+
+	return time.Time{}
+}
+
+// runningAt returns true if the pod is expected to run at t, the pods without an estimate or
+// running longer than their estimate are assumed to never end
+func (pr *PodResInfo) runningAt(t time.Time, now time.Time) bool {
+	if pr.Status == v1.PodSucceeded || pr.Status == v1.PodFailed {
+		return false
+	}
+	return pr.End.IsZero() || !pr.End.After(now) || pr.End.After(t)
+}
+
+// availableAt estimates the free resources of the node at a future time t for the pods not using the
+// emergency resources, by the expected end of the pods, bookings and placeholders
+func (rs *reserveState) availableAt(nodeInfo *NodeResInfo, t time.Time) resVector {
+	avai := make([]int64, len(nodeInfo.Capa))
+	copy(avai, nodeInfo.Capa)
+	VectorMinus(avai, nodeInfo.Headroom)
+	VectorMinus(avai, nodeInfo.Emergency)
+
+	for _, pod := range nodeInfo.Pods {
+		if pod.runningAt(t, rs.now) {
+			VectorMinus(avai, pod.Resources)
+		}
+	}
+	for _, ph := range nodeInfo.Placeholders {
+		if ph.Expires.After(t) {
+			VectorMinus(avai, ph.remaining)
+		}
+	}
+	for _, b := range rs.gr.Bookings {
+		if b.onNode(nodeInfo.Name) && b.active(t) {
+			VectorMinus(avai, b.remaining(rs.bookingUsageAt(nodeInfo, b.ID, t)))
+		}
+	}
+
+	return avai
+}
+
+// poolAvailableAt estimates the free resources of the pool at a future time t, nil if no booking
+// holds resources in the pool at t
+func (rs *reserveState) poolAvailableAt(poolName string, t time.Time) resVector {
+	var poolBookings []*bookingInfo
+	for _, b := range rs.gr.Bookings {
+		if len(poolName) > 0 && b.Pool == poolName && b.active(t) {
+			poolBookings = append(poolBookings, b)
+		}
+	}
+	if len(poolBookings) == 0 {
+		return nil
+	}
+
+	avai := make([]int64, rs.gr.ResTypeMaxKind)
+	usage := make(map[string]resVector)
+	for _, nodeInfo := range rs.gr.NodeCache {
+		if nodeInfo.Pool != poolName {
+			continue
+		}
+		VectorAdd(avai, rs.availableAt(nodeInfo, t))
+		for _, b := range poolBookings {
+			if _, ok := usage[b.ID]; !ok {
+				usage[b.ID] = make([]int64, rs.gr.ResTypeMaxKind)
+			}
+			VectorAdd(usage[b.ID], rs.bookingUsageAt(nodeInfo, b.ID, t))
+		}
+	}
+	for _, b := range poolBookings {
+		VectorMinus(avai, b.remaining(usage[b.ID]))
+	}
+
+	return avai
+}
+
+// bookingUsageAt sums the resources of the pods consuming the booking and expected to run at t
+func (rs *reserveState) bookingUsageAt(nodeInfo *NodeResInfo, bookingID string, t time.Time) resVector {
+	usage := make([]int64, len(nodeInfo.Capa))
+	for _, pod := range nodeInfo.Pods {
+		if pod.Booking == bookingID && pod.runningAt(t, rs.now) {
+			VectorAdd(usage, pod.Resources)
+		}
+	}
+	return usage
+}
+
+// AvailableUntilWithContext returns the resources which are free on the node from now until the time until
+func (gr *GloalReserve) AvailableUntilWithContext(ctx context.Context, nodeName string, until time.Time) (*NodeAvailability, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	return gr.AvailableUntil(nodeName, until)
+}
+
+// AvailableUntil returns the resources which are free on the node from now until the time until,
+// a pod using them and ending before until does not break the bookings starting later
+func (gr *GloalReserve) AvailableUntil(nodeName string, until time.Time) (*NodeAvailability, error) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	// nothing in the cache, collect all pods and nodes
+	if gr.NextResourceID == 0 {
+		gr.CollectFromLister()
+	}
+
+	nodeInfo, ok := gr.NodeCache[nodeName]
+	if !ok {
+		return nil, newReserveError(NodeNotFoundReason, "node %s does not exist", nodeName)
+	}
+
+	rs := gr.newReserveState(time.Now())
+	if !until.After(rs.now) {
+		return nil, newReserveError(InvalidRequestReason, "%v is not in the future", until)
+	}
+
+	avai := make([]int64, len(nodeInfo.Capa))
+	copy(avai, rs.node(nodeInfo))
+	VectorMinus(avai, nodeInfo.Emergency)
+	vectorMin(avai, rs.pool(nodeInfo.Pool))
+
+	// the free resources only decrease when a booking starts
+	for _, b := range gr.Bookings {
+		if !b.Start.After(rs.now) || !b.Start.Before(until) {
+			continue
+		}
+		if b.onNode(nodeInfo.Name) {
+			vectorMin(avai, rs.availableAt(nodeInfo, b.Start))
+		}
+		vectorMin(avai, rs.poolAvailableAt(nodeInfo.Pool, b.Start))
+	}
+
+	for i, v := range avai {
+		if v < 0 {
+			avai[i] = 0
+		}
+	}
+
+	return &NodeAvailability{
+		Name:      nodeName,
+		Until:     until,
+		Available: VectorToResourceList(avai, gr.ResTypeToID),
+	}, nil
+}
+
+// vectorMin sets a to the smaller one of a and b for every resource, nil b is ignored
+func vectorMin(a []int64, b []int64) {
+	for i, v := range b {
+		if i < len(a) && v < a[i] {
+			a[i] = v
+		}
+	}
+}
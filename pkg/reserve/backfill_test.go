@@ -0,0 +1,102 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetPodExpectedEnd(t *testing.T) {
+	now := time.Now()
+
+	t.Run("ExpectedEnd unknown", func(t *testing.T) {
+		if !GetPodExpectedEnd(GetPod("pod0", "1", "100", "node0", v1.PodRunning), now).IsZero() {
+			t.Errorf("unknown failed")
+		}
+	})
+
+	t.Run("ExpectedEnd annotation", func(t *testing.T) {
+		pod := GetPod("pod0", "1", "100", "node0", v1.PodRunning)
+		pod.Annotations = map[string]string{ExpectedEndAnnotation: "2020-05-01T10:00:00Z"}
+		end := GetPodExpectedEnd(pod, now)
+		if end.Unix() != time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC).Unix() {
+			t.Errorf("annotation failed")
+		}
+	})
+
+	t.Run("ExpectedEnd activeDeadlineSeconds", func(t *testing.T) {
+		var deadline int64 = 60
+		pod := GetPod("pod0", "1", "100", "node0", v1.PodRunning)
+		pod.Spec.ActiveDeadlineSeconds = &deadline
+		if !GetPodExpectedEnd(pod, now).Equal(now.Add(time.Minute)) {
+			t.Errorf("activeDeadlineSeconds before starting failed")
+		}
+		start := metav1.NewTime(now.Add(-time.Hour))
+		pod.Status.StartTime = &start
+		if !GetPodExpectedEnd(pod, now).Equal(start.Add(time.Minute)) {
+			t.Errorf("activeDeadlineSeconds failed")
+		}
+	})
+}
+
+func TestAvailableUntil(t *testing.T) {
+	now := time.Now()
+	pod0 := GetPod("pod0", "1", "100", "node0", v1.PodRunning)
+	pod0.Annotations = map[string]string{ExpectedEndAnnotation: now.Add(30 * time.Minute).Format(time.RFC3339)}
+	pod1 := GetPod("pod1", "500m", "100", "node1", v1.PodRunning)
+
+	gr := InitGR([]*v1.Node{GetNode0(), GetNode1()}, []*v1.Pod{pod0, pod1}, true)
+	b0 := getCPUBooking("b0", "2", now.Add(time.Hour))
+	b0.Nodes = []string{"node0", "node1"}
+	if err := gr.AddBooking(b0); err != nil {
+		t.Fatalf("adding booking failed with %s", err.Error())
+	}
+
+	availableCPU := func(nodeName string, until time.Time) int64 {
+		result, err := gr.AvailableUntil(nodeName, until)
+		if err != nil {
+			t.Fatalf("available until failed with %s", err.Error())
+		}
+		return result.Available.Cpu().MilliValue()
+	}
+
+	t.Run("AvailableUntil before booking", func(t *testing.T) {
+		if availableCPU("node0", now.Add(50*time.Minute)) != 1000 || availableCPU("node1", now.Add(50*time.Minute)) != 1500 {
+			t.Errorf("before booking failed")
+		}
+	})
+
+	t.Run("AvailableUntil overlapping booking", func(t *testing.T) {
+		// pod0 ends before the booking starts, pod1 never ends
+		if availableCPU("node0", now.Add(2*time.Hour)) != 0 || availableCPU("node1", now.Add(2*time.Hour)) != 0 {
+			t.Errorf("overlapping booking failed")
+		}
+	})
+
+	t.Run("AvailableUntil errors", func(t *testing.T) {
+		if _, err := gr.AvailableUntil("node9", now.Add(time.Hour)); err == nil {
+			t.Errorf("non-exist node failed")
+		}
+		if _, err := gr.AvailableUntil("node0", now.Add(-time.Hour)); err == nil {
+			t.Errorf("past time failed")
+		}
+	})
+}
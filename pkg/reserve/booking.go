@@ -0,0 +1,231 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// BookingAnnotation is the pod annotation naming the booking consumed by the pod
+const BookingAnnotation string = "globalreserve.ibm.com/booking"
+
+// Booking holds resources for a time window before the pods exist. During the window the held
+// resources are only reserved by the pods annotated with the booking ID.
+type Booking struct {
+	ID string
+	// every node holds Resources, exclusive with Pool
+	Nodes []string `json:",omitempty"`
+	// the node pool as a whole holds Resources, exclusive with Nodes
+	Pool      string `json:",omitempty"`
+	Resources v1.ResourceList
+	Start     time.Time
+	End       time.Time
+	// which scheduler creates this booking
+	Owner string `json:",omitempty"`
+}
+
+// BookingResult booking http return data struct
+type BookingResult struct {
+	Error  string
+	Reason ErrorReason `json:",omitempty"` // reason of Error
+}
+
+// bookingInfo saves a Booking in GloalReserve.Bookings
+type bookingInfo struct {
+	*Booking
+	nodes map[string]bool
+	req   resVector
+}
+
+// active returns true if now is in the booking window
+func (b *bookingInfo) active(now time.Time) bool {
+	return !now.Before(b.Start) && now.Before(b.End)
+}
+
+// onNode returns true if the node holds resources for this booking
+func (b *bookingInfo) onNode(nodeName string) bool {
+	return b.nodes[nodeName]
+}
+
+// remaining returns the resources still held after the usage of the pods consuming this booking
+func (b *bookingInfo) remaining(usage resVector) resVector {
+	hold := make([]int64, len(b.req))
+	copy(hold, b.req)
+	VectorMinus(hold, usage)
+	for i, v := range hold {
+		if v < 0 {
+			hold[i] = 0
+		}
+	}
+	return hold
+}
+
+// bookingUsage sums the resources of the pods consuming the booking, succeeded and failed pods are ignored
+func (nr *NodeResInfo) bookingUsage(bookingID string) resVector {
+	usage := make([]int64, len(nr.Capa))
+	for _, pod := range nr.Pods {
+		if pod.Booking == bookingID && pod.Status != v1.PodSucceeded && pod.Status != v1.PodFailed {
+			VectorAdd(usage, pod.Resources)
+		}
+	}
+	return usage
+}
+
+// activeBookings returns the bookings whose window contains now
+func (gr *GloalReserve) activeBookings(now time.Time) []*bookingInfo {
+	var active []*bookingInfo
+	for _, b := range gr.Bookings {
+		if b.active(now) {
+			active = append(active, b)
+		}
+	}
+
+	return active
+}
+
+// expireBookings removes the bookings whose window has ended
+func (gr *GloalReserve) expireBookings(now time.Time) {
+	for id, b := range gr.Bookings {
+		if !now.Before(b.End) {
+			klog.V(3).Infof("Booking %s is expired", id)
+			delete(gr.Bookings, id)
+		}
+	}
+}
+
+// AddBooking holds the resources for the booking. If the window has started, the resources must be
+// available now, otherwise they are not checked until the window starts.
+func (gr *GloalReserve) AddBooking(booking *Booking) error {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	// nothing in the cache, collect all pods and nodes
+	if gr.NextResourceID == 0 {
+		gr.CollectFromLister()
+	}
+
+	now := time.Now()
+	if err := gr.validateBooking(booking, now); err != nil {
+		return err
+	}
+
+	b := &bookingInfo{
+		Booking: booking,
+		nodes:   make(map[string]bool),
+		req:     make([]int64, gr.ResTypeMaxKind),
+	}
+	for _, nodeName := range booking.Nodes {
+		b.nodes[nodeName] = true
+	}
+	ResourceListToVector(booking.Resources, gr.ResTypeToID, b.req)
+
+	if gr.Bookings == nil {
+		gr.Bookings = make(map[string]*bookingInfo)
+	}
+	gr.Bookings[booking.ID] = b
+
+	if b.active(now) {
+		// the held resources can not be negative after adding the booking
+		rs := gr.newReserveState(now)
+		fit := true
+		for _, nodeName := range booking.Nodes {
+			nodeInfo := gr.NodeCache[nodeName]
+			fit = fit && VectorCompare(rs.node(nodeInfo), nodeInfo.Emergency)
+		}
+		if len(booking.Pool) > 0 {
+			fit = fit && VectorCompare(rs.pool(booking.Pool), make([]int64, gr.ResTypeMaxKind))
+		}
+		if !fit {
+			delete(gr.Bookings, booking.ID)
+			return newReserveError(InsufficientResourcesReason, "booking %s: resource is not enough", booking.ID)
+		}
+	}
+
+	klog.V(3).Infof("Add booking %s from %v to %v", booking.ID, booking.Start, booking.End)
+	return nil
+}
+
+func (gr *GloalReserve) validateBooking(booking *Booking, now time.Time) error {
+	if len(booking.ID) == 0 {
+		return newReserveError(InvalidRequestReason, "booking ID is not specified")
+	}
+	if _, ok := gr.Bookings[booking.ID]; ok {
+		return newReserveError(InvalidRequestReason, "booking %s already exists", booking.ID)
+	}
+	if !booking.End.After(booking.Start) || !booking.End.After(now) {
+		return newReserveError(InvalidRequestReason, "booking %s has an invalid window", booking.ID)
+	}
+	if len(booking.Resources) == 0 {
+		return newReserveError(InvalidRequestReason, "booking %s does not hold any resource", booking.ID)
+	}
+	if (len(booking.Nodes) > 0) == (len(booking.Pool) > 0) {
+		return newReserveError(InvalidRequestReason, "booking %s must specify either nodes or a pool", booking.ID)
+	}
+	for _, nodeName := range booking.Nodes {
+		if _, ok := gr.NodeCache[nodeName]; !ok {
+			return newReserveError(NodeNotFoundReason, "booking %s: node %s does not exist", booking.ID, nodeName)
+		}
+	}
+	if len(booking.Pool) > 0 {
+		found := false
+		for _, pool := range gr.NodePools {
+			found = found || pool.Name == booking.Pool
+		}
+		if !found {
+			return newReserveError(InvalidRequestReason, "booking %s: pool %s does not exist", booking.ID, booking.Pool)
+		}
+	}
+
+	return nil
+}
+
+// DeleteBooking releases the resources held by the booking, returns false if it does not exist
+func (gr *GloalReserve) DeleteBooking(id string) bool {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	if _, ok := gr.Bookings[id]; !ok {
+		return false
+	}
+
+	klog.V(3).Infof("Delete booking %s", id)
+	delete(gr.Bookings, id)
+	return true
+}
+
+// ListBookings returns the bookings which are not expired, sorted by start time
+func (gr *GloalReserve) ListBookings() []*Booking {
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	now := time.Now()
+	result := make([]*Booking, 0, len(gr.Bookings))
+	for _, b := range gr.Bookings {
+		if now.Before(b.End) {
+			result = append(result, b.Booking)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result
+}
@@ -0,0 +1,195 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// GetBookedPod returns a pod consuming the booking
+func GetBookedPod(name string, cpuStr string, nodename string, booking string) *v1.Pod {
+	pod := GetPod(name, cpuStr, "100", nodename, v1.PodPending)
+	pod.Annotations = map[string]string{BookingAnnotation: booking}
+	return pod
+}
+
+func getCPUBooking(id string, cpuStr string, start time.Time) *Booking {
+	return &Booking{
+		ID:        id,
+		Resources: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpuStr)},
+		Start:     start,
+		End:       start.Add(2 * time.Hour),
+	}
+}
+
+func TestAddBooking(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0()}, nil, true)
+	now := time.Now()
+
+	t.Run("AddBooking without nodes", func(t *testing.T) {
+		if err := gr.AddBooking(getCPUBooking("b0", "1", now)); ReasonForError(err) != InvalidRequestReason {
+			t.Errorf("booking without nodes failed")
+		}
+	})
+
+	t.Run("AddBooking with non-exist node", func(t *testing.T) {
+		b := getCPUBooking("b0", "1", now)
+		b.Nodes = []string{"node9"}
+		if err := gr.AddBooking(b); ReasonForError(err) != NodeNotFoundReason {
+			t.Errorf("booking with non-exist node failed")
+		}
+	})
+
+	t.Run("AddBooking with non-exist pool", func(t *testing.T) {
+		b := getCPUBooking("b0", "1", now)
+		b.Pool = "dev"
+		if err := gr.AddBooking(b); err == nil {
+			t.Errorf("booking with non-exist pool failed")
+		}
+	})
+
+	t.Run("AddBooking expired", func(t *testing.T) {
+		b := getCPUBooking("b0", "1", now.Add(-3*time.Hour))
+		b.Nodes = []string{"node0"}
+		if err := gr.AddBooking(b); err == nil {
+			t.Errorf("expired booking failed")
+		}
+	})
+
+	t.Run("AddBooking too much", func(t *testing.T) {
+		b := getCPUBooking("b0", "3", now.Add(-time.Hour))
+		b.Nodes = []string{"node0"}
+		if err := gr.AddBooking(b); ReasonForError(err) != InsufficientResourcesReason || len(gr.ListBookings()) != 0 {
+			t.Errorf("booking too much failed")
+		}
+	})
+
+	t.Run("AddBooking future booking is not checked", func(t *testing.T) {
+		b := getCPUBooking("b0", "3", now.Add(time.Hour))
+		b.Nodes = []string{"node0"}
+		if err := gr.AddBooking(b); err != nil || len(gr.ListBookings()) != 1 {
+			t.Errorf("future booking failed")
+		}
+	})
+
+	t.Run("AddBooking duplicated", func(t *testing.T) {
+		b := getCPUBooking("b0", "1", now.Add(time.Hour))
+		b.Nodes = []string{"node0"}
+		if err := gr.AddBooking(b); err == nil {
+			t.Errorf("duplicated booking failed")
+		}
+	})
+
+	t.Run("DeleteBooking", func(t *testing.T) {
+		if !gr.DeleteBooking("b0") || gr.DeleteBooking("b0") || len(gr.ListBookings()) != 0 {
+			t.Errorf("delete booking failed")
+		}
+	})
+}
+
+func TestReserveNodeBooking(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0(), GetNode1()}, nil, true)
+	now := time.Now()
+
+	b0 := getCPUBooking("b0", "1500m", now.Add(-time.Hour))
+	b0.Nodes = []string{"node0"}
+	b1 := getCPUBooking("b1", "2", now.Add(time.Hour))
+	b1.Nodes = []string{"node1"}
+	if gr.AddBooking(b0) != nil || gr.AddBooking(b1) != nil {
+		t.Fatalf("adding bookings failed")
+	}
+
+	t.Run("Reserve blocked by active booking", func(t *testing.T) {
+		if ret := gr.Reserve(GetPod("pod0", "1", "100", "node0", v1.PodPending), "node0"); len(ret) == 0 {
+			t.Errorf("blocked by active booking failed")
+		}
+	})
+
+	t.Run("Reserve not blocked by future booking", func(t *testing.T) {
+		if ret := gr.Reserve(GetPod("pod1", "1", "100", "node1", v1.PodPending), "node1"); len(ret) > 0 {
+			t.Errorf("not blocked by future booking failed")
+		}
+	})
+
+	t.Run("Reserve consumes booking", func(t *testing.T) {
+		pods := []*v1.Pod{GetBookedPod("pod2", "1", "node0", "b0"), GetBookedPod("pod3", "1", "node0", "b0")}
+		ret := gr.ReservePods(pods, []string{"node0", "node0"})
+		if len(ret.Error) > 0 {
+			t.Errorf("consumes booking failed")
+		}
+	})
+
+	t.Run("Reserve node is full", func(t *testing.T) {
+		if ret := gr.Reserve(GetBookedPod("pod4", "100m", "node0", "b0"), "node0"); len(ret) == 0 {
+			t.Errorf("node is full failed")
+		}
+	})
+
+	t.Run("Reserve released by deleting booking", func(t *testing.T) {
+		gr.DeleteBooking("b1")
+		if ret := gr.Reserve(GetPod("pod5", "1", "100", "node1", v1.PodPending), "node1"); len(ret) > 0 {
+			t.Errorf("released by deleting booking failed")
+		}
+	})
+}
+
+func TestReservePoolBooking(t *testing.T) {
+	node0 := GetNode0()
+	node0.Labels = map[string]string{"pool": "batch"}
+	node1 := GetNode1()
+	node1.Labels = map[string]string{"pool": "batch"}
+
+	gr := InitGR([]*v1.Node{node0, node1, GetNode2()}, nil, false)
+	gr.Configure(&GRConf{NodePools: []NodePoolConf{{Name: "batch", Selector: "pool=batch"}}})
+	gr.CollectFromLister()
+
+	b0 := getCPUBooking("b0", "3", time.Now().Add(-time.Hour))
+	b0.Pool = "batch"
+	if err := gr.AddBooking(b0); err != nil {
+		t.Fatalf("adding booking failed with %s", err.Error())
+	}
+
+	t.Run("Reserve pool booking leaves free resources", func(t *testing.T) {
+		if ret := gr.Reserve(GetPod("pod0", "1", "100", "node0", v1.PodPending), "node0"); len(ret) > 0 {
+			t.Errorf("leaves free resources failed")
+		}
+	})
+
+	t.Run("Reserve blocked by pool booking", func(t *testing.T) {
+		if ret := gr.Reserve(GetPod("pod1", "500m", "100", "node1", v1.PodPending), "node1"); len(ret) == 0 {
+			t.Errorf("blocked by pool booking failed")
+		}
+	})
+
+	t.Run("Reserve outside the pool", func(t *testing.T) {
+		if ret := gr.Reserve(GetPod("pod2", "2", "100", "node2", v1.PodPending), "node2"); len(ret) > 0 {
+			t.Errorf("outside the pool failed")
+		}
+	})
+
+	t.Run("Reserve consumes pool booking", func(t *testing.T) {
+		pods := []*v1.Pod{GetBookedPod("pod3", "1", "node0", "b0"), GetBookedPod("pod4", "2", "node1", "b0")}
+		ret := gr.ReservePods(pods, []string{"node0", "node1"})
+		if len(ret.Error) > 0 {
+			t.Errorf("consumes pool booking failed")
+		}
+	})
+}
@@ -0,0 +1,128 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// checkInvariants returns the broken invariants of the cache: the totals match the pods, every pod is
+// cached on one node, PodToNode matches the cached pods, and the nodes only used by reserving are not
+// overcommitted
+func checkInvariants(gr *GloalReserve, reservedOnly map[string]bool) []string {
+	var broken []string
+	for _, err := range gr.CheckConsistency() {
+		broken = append(broken, err.Error())
+	}
+
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	cached := make(map[types.UID]string)
+	for nodeName, nodeInfo := range gr.NodeCache {
+		for uid := range nodeInfo.Pods {
+			if other, ok := cached[uid]; ok {
+				broken = append(broken, fmt.Sprintf("pod %s is cached on %s and %s", uid, other, nodeName))
+			}
+			cached[uid] = nodeName
+			if gr.PodToNode[uid] != nodeName {
+				broken = append(broken, fmt.Sprintf("pod %s on %s is indexed on %q", uid, nodeName, gr.PodToNode[uid]))
+			}
+		}
+		if reservedOnly[nodeName] {
+			for i, v := range nodeInfo.GetAvailable() {
+				if v < 0 {
+					broken = append(broken, fmt.Sprintf("node %s is overcommitted on resource %d", nodeName, i))
+				}
+			}
+		}
+	}
+	for uid, nodeName := range gr.PodToNode {
+		if cached[uid] != nodeName {
+			broken = append(broken, fmt.Sprintf("pod %s is indexed on %s but not cached", uid, nodeName))
+		}
+	}
+
+	return broken
+}
+
+// TestConcurrency runs reserving and informer events from many goroutines, run it with -race
+func TestConcurrency(t *testing.T) {
+	const workers = 16
+	const rounds = 200
+
+	nodes := getNodes(8, 4)
+	gr := InitGR(nodes, nil, true)
+	gr.ReservationTTL = 0
+
+	// node0 - node3 are only used by reserving, node4 - node7 by the informer events
+	reservedOnly := map[string]bool{"node0": true, "node1": true, "node2": true, "node3": true}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < rounds; i++ {
+				name := fmt.Sprintf("pod%d-%d", w, rnd.Intn(rounds/4))
+				reserveNode := fmt.Sprintf("node%d", rnd.Intn(4))
+				eventNode := fmt.Sprintf("node%d", 4+rnd.Intn(4))
+
+				switch rnd.Intn(10) {
+				case 0, 1:
+					pods := []*v1.Pod{
+						GetPod(name+"-a", "500m", "100", "", v1.PodPending),
+						GetPod(name+"-b", "500m", "100", "", v1.PodPending),
+					}
+					gr.ReservePods(pods, []string{reserveNode, fmt.Sprintf("node%d", rnd.Intn(4))})
+				case 2:
+					gr.Reserve(GetPod(name, "1", "100", "", v1.PodPending), reserveNode)
+				case 3:
+					gr.Unreserve(GetPod(name, "1", "100", "", v1.PodPending), reserveNode)
+					gr.Unreserve(GetPod(name+"-a", "500m", "100", "", v1.PodPending), reserveNode)
+				case 4:
+					gr.AddPod(GetPod(name, "100m", "100", eventNode, v1.PodRunning))
+				case 5:
+					gr.UpdatePod(nil, GetPod(name, "100m", "100", eventNode, v1.PodRunning))
+				case 6:
+					gr.UpdatePod(nil, GetPod(name, "100m", "100", eventNode, v1.PodSucceeded))
+				case 7:
+					gr.DeletePod(cache.DeletedFinalStateUnknown{Obj: GetPod(name, "100m", "100", eventNode, v1.PodRunning)})
+				case 8:
+					gr.UpdateNode(nodes[4], getNodes(5, 4+int64(rnd.Intn(2)))[4])
+				default:
+					gr.ListNodeStatus()
+					gr.FeasibleNodes(GetPod(name, "1", "100", "", v1.PodPending))
+					gr.VerifyReservation(GetPod(name, "1", "100", "", v1.PodPending), reserveNode)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for _, b := range checkInvariants(gr, reservedOnly) {
+		t.Errorf("concurrency failed: %s", b)
+	}
+}
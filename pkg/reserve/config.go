@@ -0,0 +1,305 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// GRConfAPIVersion is the current version of GRConf
+const GRConfAPIVersion string = "globalreserve.ibm.com/v1alpha1"
+
+// DefaultRemoteTimeoutSeconds is the default timeout of the requests to the remote globalreserve
+const DefaultRemoteTimeoutSeconds int = 5
+
+// GRConf scheduler plugin configuration, call SetDefaults and Validate after decoding it
+type GRConf struct {
+	//version of the args, empty means GRConfAPIVersion
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// if globalreserve works in another pod, this field must be specified
+	RemoteURL string `json:"remoteURL,omitempty"`
+	//more remote globalreserve endpoints of the same cache, tried in order when the previous ones can not be connected
+	RemoteURLs []string `json:"remoteURLs,omitempty"`
+	//timeout of every request to the remote globalreserve
+	RemoteTimeoutSeconds int `json:"remoteTimeoutSeconds,omitempty"`
+	//scheduler name sent to the remote globalreserve, empty means ReserveSchedulerName
+	SchedulerName string `json:"schedulerName,omitempty"`
+
+	//globalreserve http server listening port, deprecated by ListenAddress, the default port is used if it is not in 1025-65534
+	Port int `json:"port,omitempty"`
+	//globalreserve http server listening address, e.g. ":23456"
+	ListenAddress string `json:"listenAddress,omitempty"`
+	//serving https by the local globalreserve, or verifying the remote globalreserve
+	TLS *TLSConf `json:"tls,omitempty"`
+
+	//number of the resource types which can be added after collecting the nodes
+	ResourceTypeBuffer int `json:"resourceTypeBuffer,omitempty"`
+	//recompute the requested and reserved totals of the nodes after every change and log the differences, slow
+	ConsistencyCheck bool `json:"consistencyCheck,omitempty"`
+	//how often the cache is reconciled with the node and pod informers, -1 means never
+	ReconcileIntervalSeconds int `json:"reconcileIntervalSeconds,omitempty"`
+
+	//shared device resources read from annotations, only used by the local globalreserve
+	SharedResources []SharedResourceConf `json:"sharedResources,omitempty"`
+	//registered name of the PodRequestExtractor, empty means the default one
+	PodRequestExtractor string `json:"podRequestExtractor,omitempty"`
+	//registered name of the NodeCapacityExtractor, empty means the default one
+	NodeCapacityExtractor string `json:"nodeCapacityExtractor,omitempty"`
+	//cluster wide overcommit ratios by resource name, e.g. {"cpu": 2.0}
+	Overcommit map[v1.ResourceName]float64 `json:"overcommit,omitempty"`
+	//resources never reserved on every node, a quantity or a percentage, e.g. {"cpu": "1", "memory": "5%"}
+	Headroom map[v1.ResourceName]string `json:"headroom,omitempty"`
+	//resources on every node only reserved by pods with priority higher than EmergencyPriority
+	Emergency map[v1.ResourceName]string `json:"emergency,omitempty"`
+	//priority threshold of the emergency resources
+	EmergencyPriority int32 `json:"emergencyPriority,omitempty"`
+	//node pools overriding the cluster wide settings
+	NodePools []NodePoolConf `json:"nodePools,omitempty"`
+	//resources every scheduler can reserve in total, key: scheduler name
+	Quotas map[string]v1.ResourceList `json:"quotas,omitempty"`
+
+	//default strategy of the placement API: first-fit, best-fit or spread
+	PlacementStrategy string `json:"placementStrategy,omitempty"`
+	//scoring the nodes by the global available resources
+	Scoring ScoringConf `json:"scoring,omitempty"`
+
+	//release the reserved pods not bound in time, 0 means never
+	ReservationTTLSeconds int `json:"reservationTTLSeconds,omitempty"`
+	//default TTL of the placeholders
+	PlaceholderTTLSeconds int `json:"placeholderTTLSeconds,omitempty"`
+	//reserve the pods with GangLabel together at the permit extension point
+	GangScheduling bool `json:"gangScheduling,omitempty"`
+	//how long the gang pods wait for the other members
+	GangTimeoutSeconds int `json:"gangTimeoutSeconds,omitempty"`
+}
+
+// TLSConf configures https between the plugin and globalreserve
+type TLSConf struct {
+	//certificate and key served by the local globalreserve
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	//CA verifying the remote globalreserve, empty means the system CAs
+	CAFile string `json:"caFile,omitempty"`
+	//do not verify the remote globalreserve, only for testing
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// LoadGRConf reads GRConf from a YAML or JSON file, then defaults and validates it. An empty path
+// returns the default configuration.
+func LoadGRConf(path string) (*GRConf, error) {
+	conf := &GRConf{}
+	if len(path) > 0 {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		if err := yaml.NewYAMLOrJSONDecoder(f, 4096).Decode(conf); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("decoding %s failed with: %s", path, err.Error())
+		}
+	}
+
+	conf.SetDefaults()
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// UnmarshalJSON decodes GRConf, the old remote-url field is accepted as remoteURL
+func (conf *GRConf) UnmarshalJSON(data []byte) error {
+	type plainConf GRConf
+	aliases := struct {
+		*plainConf
+		RemoteURLAlias string `json:"remote-url,omitempty"`
+	}{plainConf: (*plainConf)(conf)}
+
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return err
+	}
+	if len(conf.RemoteURL) == 0 {
+		conf.RemoteURL = aliases.RemoteURLAlias
+	}
+
+	return nil
+}
+
+// SetDefaults fills the fields not specified
+func (conf *GRConf) SetDefaults() {
+	if len(conf.APIVersion) == 0 {
+		conf.APIVersion = GRConfAPIVersion
+	}
+	if len(conf.ListenAddress) == 0 {
+		port := DefaultListeningPort
+		if conf.Port > 1024 && conf.Port < 65535 {
+			port = strconv.Itoa(conf.Port)
+		}
+		conf.ListenAddress = ":" + port
+	}
+	if conf.RemoteTimeoutSeconds == 0 {
+		conf.RemoteTimeoutSeconds = DefaultRemoteTimeoutSeconds
+	}
+	if conf.ResourceTypeBuffer == 0 {
+		conf.ResourceTypeBuffer = ResourceTypeBuffer
+	}
+	if len(conf.PlacementStrategy) == 0 {
+		conf.PlacementStrategy = FirstFitStrategy
+	}
+	if len(conf.Scoring.Strategy) == 0 {
+		conf.Scoring.Strategy = LeastAllocatedStrategy
+	}
+	if conf.PlaceholderTTLSeconds == 0 {
+		conf.PlaceholderTTLSeconds = int(DefaultPlaceholderTTL.Seconds())
+	}
+	if conf.GangTimeoutSeconds == 0 {
+		conf.GangTimeoutSeconds = int(DefaultGangTimeout.Seconds())
+	}
+	if conf.ReconcileIntervalSeconds == 0 {
+		conf.ReconcileIntervalSeconds = int(DefaultReconcileInterval.Seconds())
+	}
+}
+
+// Validate returns all invalid fields in one error
+func (conf *GRConf) Validate() error {
+	var errs field.ErrorList
+
+	if conf.APIVersion != GRConfAPIVersion {
+		errs = append(errs, field.NotSupported(field.NewPath("apiVersion"), conf.APIVersion, []string{GRConfAPIVersion}))
+	}
+
+	for i, remote := range conf.remoteURLs() {
+		path := field.NewPath("remoteURLs").Index(i)
+		if i == 0 && len(conf.RemoteURL) > 0 {
+			path = field.NewPath("remoteURL")
+		}
+		if u, err := url.Parse(remote); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			errs = append(errs, field.Invalid(path, remote, "must be an http or https URL"))
+		}
+	}
+	if conf.RemoteTimeoutSeconds < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("remoteTimeoutSeconds"), conf.RemoteTimeoutSeconds, "must not be negative"))
+	}
+
+	if _, port, err := net.SplitHostPort(conf.ListenAddress); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("listenAddress"), conf.ListenAddress, err.Error()))
+	} else if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("listenAddress"), conf.ListenAddress, "invalid port"))
+	}
+	if conf.TLS != nil && (len(conf.TLS.CertFile) == 0) != (len(conf.TLS.KeyFile) == 0) {
+		errs = append(errs, field.Required(field.NewPath("tls"), "certFile and keyFile must be specified together"))
+	}
+
+	if conf.ResourceTypeBuffer < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("resourceTypeBuffer"), conf.ResourceTypeBuffer, "must not be negative"))
+	}
+	if conf.ReconcileIntervalSeconds < -1 {
+		errs = append(errs, field.Invalid(field.NewPath("reconcileIntervalSeconds"), conf.ReconcileIntervalSeconds, "must be -1 or positive"))
+	}
+
+	if _, err := GetPodRequestExtractor(conf.PodRequestExtractor); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("podRequestExtractor"), conf.PodRequestExtractor, err.Error()))
+	}
+	if _, err := GetNodeCapacityExtractor(conf.NodeCapacityExtractor); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("nodeCapacityExtractor"), conf.NodeCapacityExtractor, err.Error()))
+	}
+	for i, shared := range conf.SharedResources {
+		if len(shared.Name) == 0 {
+			errs = append(errs, field.Required(field.NewPath("sharedResources").Index(i).Child("name"), ""))
+		}
+	}
+	emergencyPriority := conf.EmergencyPriority
+	if _, err := NewNodePool(&NodePoolConf{Overcommit: conf.Overcommit, Headroom: conf.Headroom,
+		Emergency: conf.Emergency, EmergencyPriority: &emergencyPriority}); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("overcommit, headroom, emergency"), "", err.Error()))
+	}
+	if _, err := NewNodePools(conf.NodePools); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("nodePools"), "", err.Error()))
+	}
+	for scheduler := range conf.Quotas {
+		if len(scheduler) == 0 {
+			errs = append(errs, field.Required(field.NewPath("quotas").Key(scheduler), "scheduler name is empty"))
+		}
+	}
+
+	if err := ValidatePlacementStrategy(conf.PlacementStrategy); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("placementStrategy"), conf.PlacementStrategy, err.Error()))
+	}
+	if err := conf.Scoring.Validate(); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("scoring"), conf.Scoring, err.Error()))
+	}
+
+	for name, value := range map[string]int{
+		"reservationTTLSeconds": conf.ReservationTTLSeconds,
+		"placeholderTTLSeconds": conf.PlaceholderTTLSeconds,
+		"gangTimeoutSeconds":    conf.GangTimeoutSeconds,
+	} {
+		if value < 0 {
+			errs = append(errs, field.Invalid(field.NewPath(name), value, "must not be negative"))
+		}
+	}
+
+	if err := errs.ToAggregate(); err != nil {
+		return fmt.Errorf("invalid %s args: %v", Name, err)
+	}
+	return nil
+}
+
+// remoteURLs returns RemoteURL followed by RemoteURLs
+func (conf *GRConf) remoteURLs() []string {
+	var urls []string
+	if len(conf.RemoteURL) > 0 {
+		urls = append(urls, conf.RemoteURL)
+	}
+	return append(urls, conf.RemoteURLs...)
+}
+
+// clientTLSConfig returns the tls.Config verifying the remote globalreserve, nil if TLS is not configured
+func (conf *GRConf) clientTLSConfig() (*tls.Config, error) {
+	if conf.TLS == nil {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: conf.TLS.InsecureSkipVerify}
+	if len(conf.TLS.CAFile) > 0 {
+		caData, err := ioutil.ReadFile(conf.TLS.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no certificate is found in %s", conf.TLS.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
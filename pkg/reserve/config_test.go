@@ -0,0 +1,268 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	framework "k8s.io/kubernetes/pkg/scheduler/framework/v1alpha1"
+)
+
+// decodeConf decodes the plugin args like the scheduler framework, then defaults and validates them
+func decodeConf(args []byte) (*GRConf, error) {
+	conf := &GRConf{}
+	if err := framework.DecodeInto(&runtime.Unknown{Raw: args}, conf); err != nil {
+		return nil, err
+	}
+	conf.SetDefaults()
+	return conf, conf.Validate()
+}
+
+// manifestArgs returns the args of the plugin in the scheduler configuration shipped in the manifest
+func manifestArgs(t *testing.T, path string) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s failed with %s", path, err.Error())
+	}
+	defer f.Close()
+
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		var cm v1.ConfigMap
+		if err := decoder.Decode(&cm); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("decode %s failed with %s", path, err.Error())
+		}
+		if cm.Kind != "ConfigMap" {
+			continue
+		}
+
+		var schedConf struct {
+			PluginConfig []struct {
+				Name string          `json:"name"`
+				Args json.RawMessage `json:"args"`
+			} `json:"pluginConfig"`
+		}
+		data := strings.NewReader(cm.Data["scheduler-config.yaml"])
+		if err := yaml.NewYAMLOrJSONDecoder(data, 4096).Decode(&schedConf); err != nil {
+			t.Fatalf("decode scheduler config in %s failed with %s", path, err.Error())
+		}
+		for _, pc := range schedConf.PluginConfig {
+			if pc.Name == Name {
+				return pc.Args
+			}
+		}
+	}
+
+	t.Fatalf("no args of %s in %s", Name, path)
+	return nil
+}
+
+func TestGRConfManifests(t *testing.T) {
+	t.Run("GRConfManifests local", func(t *testing.T) {
+		conf, err := decodeConf(manifestArgs(t, filepath.Join("..", "..", "deployment", "globalreserve-deployment.yaml")))
+		if err != nil || len(conf.remoteURLs()) != 0 || conf.ListenAddress != ":23456" {
+			t.Errorf("local failed: %v", err)
+		}
+	})
+
+	t.Run("GRConfManifests remote", func(t *testing.T) {
+		args := manifestArgs(t, filepath.Join("..", "..", "deployment", "globalreserve-deployment-remote.yaml"))
+		if !strings.Contains(string(args), `"remote-url"`) {
+			t.Errorf("remote failed, the manifest does not use the remote-url key")
+		}
+		conf, err := decodeConf(args)
+		if err != nil || len(conf.remoteURLs()) != 1 || conf.RemoteURL != "http://3rdparty-scheduler-pod:23456" {
+			t.Errorf("remote failed: %v", err)
+		}
+	})
+}
+
+func TestGRConfDefaults(t *testing.T) {
+	t.Run("GRConfDefaults empty", func(t *testing.T) {
+		conf, err := decodeConf([]byte("{}"))
+		if err != nil || conf.APIVersion != GRConfAPIVersion || conf.ListenAddress != ":"+DefaultListeningPort ||
+			conf.RemoteTimeoutSeconds != DefaultRemoteTimeoutSeconds || conf.ResourceTypeBuffer != ResourceTypeBuffer ||
+			conf.PlacementStrategy != FirstFitStrategy || conf.Scoring.Strategy != LeastAllocatedStrategy ||
+			conf.PlaceholderTTLSeconds != 300 || conf.GangTimeoutSeconds != 60 {
+			t.Errorf("empty failed: %v %+v", err, conf)
+		}
+	})
+
+	t.Run("GRConfDefaults port", func(t *testing.T) {
+		if conf, err := decodeConf([]byte(`{"port": 12345}`)); err != nil || conf.ListenAddress != ":12345" {
+			t.Errorf("port failed")
+		}
+	})
+
+	t.Run("GRConfDefaults port out of range", func(t *testing.T) {
+		if conf, err := decodeConf([]byte(`{"port": 80}`)); err != nil || conf.ListenAddress != ":"+DefaultListeningPort {
+			t.Errorf("port out of range failed")
+		}
+	})
+
+	t.Run("GRConfDefaults remote-url alias", func(t *testing.T) {
+		conf, err := decodeConf([]byte(`{"remote-url": "http://gr:23456", "remoteURLs": ["https://gr2:23456"]}`))
+		if err != nil || len(conf.remoteURLs()) != 2 || conf.remoteURLs()[0] != "http://gr:23456" {
+			t.Errorf("remote-url alias failed")
+		}
+	})
+}
+
+func TestGRConfValidate(t *testing.T) {
+	t.Run("GRConfValidate all errors", func(t *testing.T) {
+		_, err := decodeConf([]byte(`{"apiVersion": "v2", "remoteURL": "gr:23456", "listenAddress": "gr",
+			"tls": {"certFile": "cert.pem"}, "placementStrategy": "random", "reservationTTLSeconds": -1}`))
+		if err == nil {
+			t.Fatalf("all errors failed")
+		}
+		for _, path := range []string{"apiVersion", "remoteURL", "listenAddress", "tls", "placementStrategy", "reservationTTLSeconds"} {
+			if !strings.Contains(err.Error(), path) {
+				t.Errorf("all errors failed, %s is not reported in %s", path, err.Error())
+			}
+		}
+	})
+
+	t.Run("GRConfValidate listen address", func(t *testing.T) {
+		if _, err := decodeConf([]byte(`{"listenAddress": "23456"}`)); err == nil {
+			t.Errorf("listen address failed")
+		}
+		if _, err := decodeConf([]byte(`{"listenAddress": "127.0.0.1:23456"}`)); err != nil {
+			t.Errorf("listen address with host failed")
+		}
+	})
+
+	t.Run("GRConfValidate extractor and pools", func(t *testing.T) {
+		if _, err := decodeConf([]byte(`{"podRequestExtractor": "none"}`)); err == nil {
+			t.Errorf("extractor failed")
+		}
+		if _, err := decodeConf([]byte(`{"nodePools": [{"name": "p", "selector": "a in ("}]}`)); err == nil {
+			t.Errorf("pools failed")
+		}
+	})
+}
+
+func TestQuota(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0(), GetNode1()}, nil, true)
+	gr.Quotas = map[string]v1.ResourceList{
+		"batch": {v1.ResourceCPU: *resource.NewMilliQuantity(1500, resource.DecimalSI)},
+	}
+
+	batchPod := func(name string, cpu string, nodeName string) *v1.Pod {
+		pod := GetPod(name, cpu, "100", nodeName, v1.PodPending)
+		pod.Spec.SchedulerName = "batch"
+		return pod
+	}
+
+	t.Run("Quota within", func(t *testing.T) {
+		if ret := gr.Reserve(batchPod("pod0", "1", "node0"), "node0"); len(ret) > 0 {
+			t.Errorf("within failed: %s", ret)
+		}
+	})
+
+	t.Run("Quota exceeded across nodes", func(t *testing.T) {
+		if ret := gr.Reserve(batchPod("pod1", "1", "node1"), "node1"); len(ret) == 0 {
+			t.Errorf("exceeded failed")
+		}
+	})
+
+	t.Run("Quota other scheduler", func(t *testing.T) {
+		if ret := gr.Reserve(GetPod("pod2", "1", "100", "node1", v1.PodPending), "node1"); len(ret) > 0 {
+			t.Errorf("other scheduler failed: %s", ret)
+		}
+	})
+	t.Run("Quota freed by succeeded pod", func(t *testing.T) {
+		// pod0 is bound and then succeeded, its requests do not count in the quota any more
+		gr.UpdatePod(nil, batchPod("pod0", "1", "node0"))
+		pod0 := batchPod("pod0", "1", "node0")
+		pod0.Status.Phase = v1.PodSucceeded
+		gr.UpdatePod(nil, pod0)
+		if _, ok := gr.NodeCache["node0"].SchedulerUsage["batch"]; ok {
+			t.Errorf("freed by succeeded pod failed, the usage is %v", gr.NodeCache["node0"].SchedulerUsage)
+		}
+		if ret := gr.Reserve(batchPod("pod1", "1", "node1"), "node1"); len(ret) > 0 {
+			t.Errorf("freed by succeeded pod failed: %s", ret)
+		}
+		if errs := gr.CheckConsistency(); len(errs) > 0 {
+			t.Errorf("freed by succeeded pod failed: %v", errs)
+		}
+	})
+}
+
+func TestHTTPClientFailover(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0()}, nil, true)
+	ser, err := InitHTTPServer(gr)
+	if err != nil {
+		t.Fatalf("starting the http server failed with %s", err.Error())
+	}
+	defer ser.Close()
+
+	conf := &GRConf{RemoteURLs: []string{"http://127.0.0.1:1", ser.URL()}}
+	conf.SetDefaults()
+	ghc, err := NewHTTPClientFromConf(conf)
+	if err != nil {
+		t.Fatalf("create client failed with %s", err.Error())
+	}
+
+	t.Run("HTTPClientFailover second endpoint", func(t *testing.T) {
+		if ret := ghc.Reserve(GetPod("pod0", "1", "100", "node0", v1.PodPending), "node0"); len(ret) > 0 {
+			t.Errorf("second endpoint failed: %s", ret)
+		}
+	})
+
+	// the first endpoint drops the connection after reading the request, it may have applied it
+	dropping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			conn.Close()
+		}
+	}))
+	defer dropping.Close()
+	conf = &GRConf{RemoteURLs: []string{dropping.URL, ser.URL()}}
+	conf.SetDefaults()
+	ghc, err = NewHTTPClientFromConf(conf)
+	if err != nil {
+		t.Fatalf("create client failed with %s", err.Error())
+	}
+
+	t.Run("HTTPClientFailover reserve is not resent", func(t *testing.T) {
+		pod1 := GetPod("pod1", "500m", "100", "node0", v1.PodPending)
+		if ret := ghc.Reserve(pod1, "node0"); len(ret) == 0 {
+			t.Errorf("reserve is not resent failed")
+		}
+		if _, ok := gr.PodToNode[pod1.UID]; ok {
+			t.Errorf("reserve is not resent failed, the pod is reserved by the second endpoint")
+		}
+	})
+
+	t.Run("HTTPClientFailover get is resent", func(t *testing.T) {
+		if _, err := ghc.(*GloalReserveHTTPClient).GetNodeStatus("node0"); err != nil {
+			t.Errorf("get is resent failed: %s", err.Error())
+		}
+	})
+}
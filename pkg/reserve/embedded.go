@@ -0,0 +1,184 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// EmbeddedReserve hosts GloalReserve in the process of a Go scheduler which does not use the scheduler
+// framework. The scheduler calls the GlobalReserverInterface methods of the embedded GloalReserve
+// directly, other schedulers use the REST API if ServeHTTP is true.
+//
+//	er, err := reserve.NewEmbeddedReserveForClient(client, conf, true)
+//	if err := er.Start(); err != nil { ... }
+//	defer er.Stop()
+//	result := er.ReservePods(pods, nodeNames)
+type EmbeddedReserve struct {
+	*GloalReserve
+	ServeHTTP bool // serve the REST API on ListenAddress between Start and Stop
+
+	client        kubernetes.Interface // creates the informers owned by er, nil if the factory is shared
+	factory       informers.SharedInformerFactory
+	started       bool          // the informers of factory have been started
+	sharedStopCh  chan struct{} // never closed, the informers of a shared factory are stopped by its owner
+	listenAddress string
+	tls           *TLSConf
+	stopCh        chan struct{}
+	server        *ReserveServer
+}
+
+var _ GlobalReserverInterface = &EmbeddedReserve{}
+
+// NewEmbeddedReserve returns an EmbeddedReserve fed by the node and pod informers of factory, the
+// factory may be shared with the scheduler and is never stopped by Stop. conf is defaulted and
+// validated.
+func NewEmbeddedReserve(factory informers.SharedInformerFactory, conf *GRConf, serveHTTP bool) (*EmbeddedReserve, error) {
+	conf.SetDefaults()
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	gr, err := NewInformerReserve(factory, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EmbeddedReserve{
+		GloalReserve:  gr,
+		ServeHTTP:     serveHTTP,
+		factory:       factory,
+		sharedStopCh:  make(chan struct{}),
+		listenAddress: conf.ListenAddress,
+		tls:           conf.TLS,
+	}, nil
+}
+
+// NewEmbeddedReserveForClient returns an EmbeddedReserve with its own informers created from client,
+// they are stopped by Stop
+func NewEmbeddedReserveForClient(client kubernetes.Interface, conf *GRConf, serveHTTP bool) (*EmbeddedReserve, error) {
+	er, err := NewEmbeddedReserve(informers.NewSharedInformerFactory(client, 0), conf, serveHTTP)
+	if err != nil {
+		return nil, err
+	}
+	er.client = client
+
+	return er, nil
+}
+
+// Start starts the informers if they are not started yet, waits until they are synced and fills the
+// cache, then starts the http server if ServeHTTP is true. It returns after the server is listening.
+// After Stop, the owned informers are replaced by new ones and the cache is reconciled with them.
+func (er *EmbeddedReserve) Start() error {
+	if er.stopCh != nil {
+		return fmt.Errorf("GloalReserve is already started")
+	}
+	er.stopCh = make(chan struct{})
+
+	informerStopCh := er.stopCh
+	restarted := er.started && er.client != nil
+	if er.client == nil {
+		informerStopCh = er.sharedStopCh
+	} else if restarted {
+		// stopped informers can not be started again
+		er.setFactory(informers.NewSharedInformerFactory(er.client, 0))
+	}
+	er.started = true
+
+	er.factory.Start(informerStopCh)
+	for informerType, synced := range er.factory.WaitForCacheSync(er.stopCh) {
+		if !synced {
+			er.Stop()
+			return fmt.Errorf("syncing informer %v failed", informerType)
+		}
+	}
+	if err := er.Collect(); err != nil {
+		er.Stop()
+		return err
+	}
+	if restarted {
+		// the events between Stop and Start are lost
+		er.Reconcile()
+	}
+
+	if er.ReconcileInterval > 0 {
+		go er.getReconciler().Run(er.stopCh)
+	}
+
+	if !er.ServeHTTP {
+		return nil
+	}
+
+	server, err := StartHTTPServer(er.GloalReserve, er.listenAddress, er.tls)
+	if err != nil {
+		er.Stop()
+		return err
+	}
+	er.server = server
+
+	return nil
+}
+
+// setFactory feeds the cache by the informers of factory instead of the stopped ones
+func (er *EmbeddedReserve) setFactory(factory informers.SharedInformerFactory) {
+	er.AddEventHandlers(factory)
+	nodeLister := NewInformerNodeInfoLister(factory.Core().V1().Nodes().Lister())
+	podLister := NewInformerPodLister(factory.Core().V1().Pods().Lister())
+
+	r := er.getReconciler()
+	r.mu.Lock()
+	er.mu.Lock()
+	er.NodeLister, er.PodLister = nodeLister, podLister
+	r.nodeLister, r.podLister = nodeLister, podLister
+	er.mu.Unlock()
+	r.mu.Unlock()
+
+	er.factory = factory
+}
+
+// Stop shuts down the http server after the in-flight requests are done and stops the informers
+// owned by er, the informers of a shared factory keep running. The cache is kept and Start can be
+// called again.
+func (er *EmbeddedReserve) Stop() {
+	if er.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := er.server.Shutdown(ctx); err != nil {
+			klog.Errorf("Shutting down GloalReserve http server failed with: %s", err.Error())
+		}
+		er.server = nil
+	}
+	if er.stopCh != nil {
+		close(er.stopCh)
+		er.stopCh = nil
+	}
+}
+
+// Addr returns the address the http server is listening, empty if it is not serving. It is useful when
+// ListenAddress has port 0.
+func (er *EmbeddedReserve) Addr() string {
+	if er.server == nil {
+		return ""
+	}
+	return er.server.Addr()
+}
@@ -0,0 +1,123 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEmbeddedReserve(t *testing.T) {
+	client := fake.NewSimpleClientset(GetNode0(), GetNode1())
+	er, err := NewEmbeddedReserveForClient(client, &GRConf{ListenAddress: "127.0.0.1:0"}, true)
+	if err != nil {
+		t.Fatalf("create failed with %s", err.Error())
+	}
+	if err := er.Start(); err != nil {
+		t.Fatalf("start failed with %s", err.Error())
+	}
+
+	pods := []*v1.Pod{
+		GetPod("pod0", "1", "100", "node0", v1.PodPending),
+		GetPod("pod1", "1", "100", "node1", v1.PodPending),
+	}
+	nodeNames := []string{"node0", "node1"}
+
+	t.Run("EmbeddedReserve reserve pods", func(t *testing.T) {
+		if ret := er.ReservePods(pods, nodeNames); len(ret.Error) > 0 || len(er.PodToNode) != 2 {
+			t.Errorf("reserve pods failed")
+		}
+	})
+
+	t.Run("EmbeddedReserve unreserve pods by http", func(t *testing.T) {
+		ghc, _ := NewHTTPClient("http://"+er.Addr(), 5)
+		ghc.UnreservePods(pods, nodeNames)
+		if len(er.PodToNode) != 0 {
+			t.Errorf("unreserve pods by http failed")
+		}
+	})
+
+	t.Run("EmbeddedReserve stop", func(t *testing.T) {
+		er.Stop()
+		if len(er.Addr()) > 0 || er.Start() != nil {
+			t.Errorf("stop failed")
+		}
+	})
+
+	t.Run("EmbeddedReserve events after restart", func(t *testing.T) {
+		client.CoreV1().Nodes().Create(GetNode2())
+		if !waitNodeCached(er.GloalReserve, "node2") {
+			t.Errorf("events after restart failed, node2 is not cached")
+		}
+		er.Stop()
+	})
+
+	t.Run("EmbeddedReserve invalid conf", func(t *testing.T) {
+		if _, err := NewEmbeddedReserveForClient(client, &GRConf{ListenAddress: "localhost"}, true); err == nil {
+			t.Errorf("invalid conf failed")
+		}
+	})
+}
+
+func TestEmbeddedReserveSharedFactory(t *testing.T) {
+	client := fake.NewSimpleClientset(GetNode0())
+	factory := informers.NewSharedInformerFactory(client, 0)
+	er, err := NewEmbeddedReserve(factory, &GRConf{}, false)
+	if err != nil {
+		t.Fatalf("create failed with %s", err.Error())
+	}
+	if err := er.Start(); err != nil {
+		t.Fatalf("start failed with %s", err.Error())
+	}
+
+	t.Run("EmbeddedReserveSharedFactory informers keep running after stop", func(t *testing.T) {
+		er.Stop()
+		client.CoreV1().Nodes().Create(GetNode1())
+		if !waitNodeCached(er.GloalReserve, "node1") {
+			t.Errorf("informers keep running after stop failed")
+		}
+	})
+
+	t.Run("EmbeddedReserveSharedFactory restart", func(t *testing.T) {
+		if err := er.Start(); err != nil {
+			t.Fatalf("restart failed with %s", err.Error())
+		}
+		defer er.Stop()
+		client.CoreV1().Nodes().Create(GetNode2())
+		if !waitNodeCached(er.GloalReserve, "node2") {
+			t.Errorf("restart failed, node2 is not cached")
+		}
+	})
+}
+
+// waitNodeCached waits up to one second until the node is added to the cache by the informer
+func waitNodeCached(gr *GloalReserve, nodeName string) bool {
+	for i := 0; i < 100; i++ {
+		gr.mu.RLock()
+		_, ok := gr.NodeCache[nodeName]
+		gr.mu.RUnlock()
+		if ok {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
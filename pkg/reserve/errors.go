@@ -0,0 +1,155 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ErrorReason classifies the errors returned by GlobalReserverInterface, it is the same in the local
+// and remote modes
+type ErrorReason string
+
+const (
+	// NodeNotFoundReason the node is not in the cache
+	NodeNotFoundReason ErrorReason = "NodeNotFound"
+	// InsufficientResourcesReason the node, pool or quota does not have enough resources for the pod
+	InsufficientResourcesReason ErrorReason = "InsufficientResources"
+	// NotReservedReason the pod is not reserved on the node
+	NotReservedReason ErrorReason = "NotReserved"
+	// ReservationExpiredReason the reservation is not bound within the reservation TTL
+	ReservationExpiredReason ErrorReason = "ReservationExpired"
+	// AbortedReason the pod could be reserved, but the batch failed because of other pods
+	AbortedReason ErrorReason = "Aborted"
+	// InvalidRequestReason the request is malformed
+	InvalidRequestReason ErrorReason = "InvalidRequest"
+	// CanceledReason the context is canceled or its deadline is exceeded
+	CanceledReason ErrorReason = "Canceled"
+	// UnavailableReason the remote GloalReserve can not be connected
+	UnavailableReason ErrorReason = "Unavailable"
+	// UnknownReason the error is not a ReserveError
+	UnknownReason ErrorReason = "Unknown"
+)
+
+// ReserveError is the typed error returned by GlobalReserverInterface
+type ReserveError struct {
+	Reason  ErrorReason
+	Message string
+}
+
+func (e *ReserveError) Error() string {
+	return e.Message
+}
+
+func newReserveError(reason ErrorReason, format string, args ...interface{}) *ReserveError {
+	return &ReserveError{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// ReasonForError returns the reason of err, UnknownReason if err is not a ReserveError and empty
+// if err is nil
+func ReasonForError(err error) ErrorReason {
+	if err == nil {
+		return ""
+	}
+	if e, ok := err.(*ReserveError); ok {
+		return e.Reason
+	}
+	return UnknownReason
+}
+
+// errorFromResult rebuilds the typed error sent by the http server
+func errorFromResult(reason ErrorReason, message string) error {
+	if len(message) == 0 {
+		return nil
+	}
+	if len(reason) == 0 {
+		reason = UnknownReason
+	}
+	return &ReserveError{Reason: reason, Message: message}
+}
+
+// contextError returns a CanceledReason error if ctx is done
+func contextError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return newReserveError(CanceledReason, "%s", err.Error())
+	}
+	return nil
+}
+
+// statusError converts an unexpected http status into a typed error
+func statusError(status int, format string, args ...interface{}) error {
+	reason := UnknownReason
+	switch status {
+	case http.StatusBadRequest:
+		reason = InvalidRequestReason
+	case http.StatusNotFound:
+		reason = NodeNotFoundReason
+	}
+	return newReserveError(reason, format, args...)
+}
+
+func (r *PodResult) setError(err error) {
+	r.Reason = ReasonForError(err)
+	r.Error = err.Error()
+}
+
+// abortResults marks the successful pods in a failed batch as aborted, it returns the error of the
+// first failed pod
+func abortResults(results []PodResult) ([]PodResult, error) {
+	var firstErr error
+	for i := range results {
+		if len(results[i].Error) > 0 {
+			if firstErr == nil {
+				firstErr = results[i].Err()
+			}
+			continue
+		}
+		results[i].Zone = ""
+		results[i].setError(newReserveError(AbortedReason, "pod %s is not reserved because other pods failed", results[i].Pod))
+	}
+	return results, firstErr
+}
+
+// newPodReserveResult converts the per pod results into the http return data
+func newPodReserveResult(results []PodResult, err error) *PodReserveResult {
+	result := &PodReserveResult{
+		FailedPods: make([]string, 0, len(results)),
+		Error:      "",
+		Results:    results,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Reason = ReasonForError(err)
+	}
+
+	zones := make(map[string]string)
+	for _, r := range results {
+		if len(r.Error) > 0 && r.Reason != AbortedReason {
+			result.FailedPods = append(result.FailedPods, r.Pod)
+		}
+		if len(r.Zone) > 0 {
+			zones[r.Pod] = r.Zone
+		}
+	}
+	if err == nil {
+		result.Zones = zones
+	}
+
+	return result
+}
@@ -0,0 +1,137 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// testReserverWithContext runs the same checks against the local and remote implementations
+func testReserverWithContext(t *testing.T, impl GlobalReserverInterface) {
+	ctx := context.TODO()
+	pod0 := GetPod("pod0", "1", "100", "node0", v1.PodPending)
+	pod1 := GetPod("pod1", "1500m", "100", "node0", v1.PodPending)
+	pod2 := GetPod("pod2", "500m", "100", "node1", v1.PodPending)
+
+	t.Run("reserve", func(t *testing.T) {
+		if err := impl.ReserveWithContext(ctx, pod0, "node0"); err != nil {
+			t.Errorf("reserve failed with %v", err)
+		}
+	})
+
+	t.Run("node not found", func(t *testing.T) {
+		if err := impl.ReserveWithContext(ctx, pod1, "node9"); ReasonForError(err) != NodeNotFoundReason {
+			t.Errorf("node not found failed with %v", err)
+		}
+	})
+
+	t.Run("batch per pod results", func(t *testing.T) {
+		results, err := impl.ReservePodsWithContext(ctx, []*v1.Pod{pod2, pod1}, []string{"node1", "node0"})
+		if ReasonForError(err) != InsufficientResourcesReason || len(results) != 2 ||
+			results[0].Reason != AbortedReason || results[1].Reason != InsufficientResourcesReason ||
+			ReasonForError(results[1].Err()) != InsufficientResourcesReason {
+			t.Errorf("batch per pod results failed with %v %+v", err, results)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := impl.ReserveWithContext(canceled, pod2, "node1"); ReasonForError(err) != CanceledReason {
+			t.Errorf("canceled failed with %v", err)
+		}
+	})
+
+	t.Run("queries", func(t *testing.T) {
+		if status, err := impl.ListNodeStatusWithContext(ctx); err != nil || len(status) != 2 {
+			t.Errorf("list failed with %v", err)
+		}
+		if avai, err := impl.AvailableUntilWithContext(ctx, "node0", time.Now().Add(time.Hour)); err != nil || avai.Name != "node0" {
+			t.Errorf("available until failed with %v", err)
+		}
+		if _, err := impl.AvailableUntilWithContext(ctx, "node9", time.Now().Add(time.Hour)); ReasonForError(err) != NodeNotFoundReason {
+			t.Errorf("available until node not found failed with %v", err)
+		}
+	})
+
+	t.Run("verify and unreserve", func(t *testing.T) {
+		if err := impl.UnreserveWithContext(ctx, pod0, "node0"); err != nil {
+			t.Errorf("unreserve failed with %v", err)
+		}
+		if err := impl.VerifyReservation(pod0, "node0"); ReasonForError(err) != NotReservedReason {
+			t.Errorf("verify unreserved failed with %v", err)
+		}
+	})
+}
+
+func TestReserverWithContext(t *testing.T) {
+	t.Run("local", func(t *testing.T) {
+		testReserverWithContext(t, InitGR([]*v1.Node{GetNode0(), GetNode1()}, nil, true))
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		gr := InitGR([]*v1.Node{GetNode0(), GetNode1()}, nil, true)
+		ser, err := InitHTTPServer(gr)
+		if err != nil {
+			t.Fatalf("starting the http server failed with %s", err.Error())
+		}
+		defer ser.Close()
+
+		ghc, _ := NewHTTPClient(ser.URL(), 5)
+		testReserverWithContext(t, ghc)
+	})
+
+	t.Run("remote client gives up", func(t *testing.T) {
+		gr := InitGR([]*v1.Node{GetNode0(), GetNode1()}, nil, true)
+		ser, err := InitHTTPServer(gr)
+		if err != nil {
+			t.Fatalf("starting the http server failed with %s", err.Error())
+		}
+		defer ser.Close()
+		ghc, _ := NewHTTPClient(ser.URL(), 5)
+
+		// the request waits for the lock until the client gives up
+		pod0 := GetPod("pod0", "1", "100", "node0", v1.PodPending)
+		gr.mu.Lock()
+		ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+		err = ghc.ReserveWithContext(ctx, pod0, "node0")
+		cancel()
+		time.Sleep(100 * time.Millisecond)
+		gr.mu.Unlock()
+
+		if ReasonForError(err) != CanceledReason {
+			t.Errorf("client gives up failed with %v", err)
+		}
+		// the handler sees the canceled request after getting the lock
+		time.Sleep(100 * time.Millisecond)
+		if _, ok := gr.podNode(pod0.UID); ok {
+			t.Errorf("client gives up failed, the pod is still reserved")
+		}
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		ghc, _ := NewHTTPClient("http://127.0.0.1:1", 5)
+		err := ghc.ReserveWithContext(context.TODO(), GetPod("pod0", "1", "100", "node0", v1.PodPending), "node0")
+		if ReasonForError(err) != UnavailableReason {
+			t.Errorf("unavailable failed with %v", err)
+		}
+	})
+}
@@ -18,35 +18,42 @@ package reserve
 
 import (
 	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
 )
 
+// bindPodRetries is the number of tries to update a bound pod under the read lock, see bindPod
+const bindPodRetries int = 3
+
 // AddNode into GlobalReserve, called by Node watcher
 func (gr *GloalReserve) AddNode(obj interface{}) {
-	if gr.NextResourceID == 0 {
-		klog.V(3).Infof("CollectFromLister is not called.")
-		return
-	}
-
 	node, ok := obj.(*v1.Node)
 	if !ok {
 		klog.Errorf("cannot convert to *v1.Node: %v", obj)
 		return
 	}
 
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	if gr.NextResourceID == 0 {
+		klog.V(3).Infof("CollectFromLister is not called.")
+		return
+	}
 	if _, ok := gr.NodeCache[node.Name]; ok {
 		klog.V(3).Infof("Node %s is already exist.", node.Name)
 		return
 	}
 
 	klog.V(3).Infof("add event for node %s ", node.Name)
+	gr.addResTypes(node)
+	gr.NodeCache[node.Name] = gr.newNodeResInfo(node)
+}
 
-	gr.mu.Lock()
-	defer gr.mu.Unlock()
-
-	//check the resouce name, ensure the name is already in ResTypeToID
-	for resName := range node.Status.Allocatable {
+// addResTypes checks the resouce names of the node, ensure the names are already in ResTypeToID
+func (gr *GloalReserve) addResTypes(node *v1.Node) {
+	for resName := range gr.nodeCapacity(node) {
 		if _, ok := gr.ResTypeToID[resName]; !ok {
 			// new resource name is imported, need to enlarge the resource slice capability
 			if gr.NextResourceID >= gr.ResTypeMaxKind {
@@ -58,14 +65,50 @@ func (gr *GloalReserve) AddNode(obj interface{}) {
 			gr.NextResourceID++
 		}
 	}
-
-	gr.NodeCache[node.Name] = NewNodeResInfo(node, gr.ResTypeToID, gr.ResTypeMaxKind)
 }
 
-// UpdateNode in GlobalReserve, called by Node watcher, this function ignores the events currently
+// UpdateNode in GlobalReserve, called by Node watcher, the capacity is rebuilt when the labels,
+// annotations or allocatable resources are changed
 func (gr *GloalReserve) UpdateNode(oldObj, newObj interface{}) {
-	//global reserve does not care about node updating event, ignore it.
-	return
+	oldNode, ok := oldObj.(*v1.Node)
+	if !ok {
+		klog.Errorf("cannot convert oldObj to *v1.Node: %v", oldObj)
+		return
+	}
+	newNode, ok := newObj.(*v1.Node)
+	if !ok {
+		klog.Errorf("cannot convert newObj to *v1.Node: %v", newObj)
+		return
+	}
+
+	if apiequality.Semantic.DeepEqual(oldNode.Labels, newNode.Labels) &&
+		apiequality.Semantic.DeepEqual(oldNode.Annotations, newNode.Annotations) &&
+		apiequality.Semantic.DeepEqual(oldNode.Status.Allocatable, newNode.Status.Allocatable) {
+		return
+	}
+
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	nodeInfo, ok := gr.NodeCache[newNode.Name]
+	if !ok {
+		return
+	}
+
+	klog.V(3).Infof("update event for node %s", newNode.Name)
+	gr.addResTypes(newNode)
+	newNodeInfo := gr.newNodeResInfo(newNode)
+	newNodeInfo.Pods = nodeInfo.Pods
+	newNodeInfo.Requested = nodeInfo.Requested
+	newNodeInfo.Reserved = nodeInfo.Reserved
+	newNodeInfo.SchedulerUsage = nodeInfo.SchedulerUsage
+	newNodeInfo.Placeholders = nodeInfo.Placeholders
+	// the zones fed by SetNodeZones are recalculated with the new capacity
+	if len(nodeInfo.fedZones) > 0 && GetNodeZones(newNode) == nil {
+		newNodeInfo.SetZones(nodeInfo.fedZones, gr.ResTypeToID)
+		newNodeInfo.fedZones = nodeInfo.fedZones
+	}
+	gr.NodeCache[newNode.Name] = newNodeInfo
 }
 
 // DeleteNode from GlobalReserve, called by Node watcher
@@ -105,32 +148,52 @@ func (gr *GloalReserve) AddPod(obj interface{}) {
 		klog.Errorf("cannot convert to *v1.Pod: %v", obj)
 		return
 	}
-	klog.V(3).Infof("add event for scheduled pod %s/%s UID: %s ", pod.Namespace, pod.Name, pod.UID)
-
-	if gr.NextResourceID == 0 {
-		klog.V(3).Infof("CollectFromLister is not called.")
-		return
-	}
+	klog.V(3).Infof("add event for scheduled pod %s UID: %s ", PodKey(pod), pod.UID)
 
 	hostname := pod.Spec.NodeName
 	if len(hostname) > 0 {
-		gr.mu.Lock()
-		defer gr.mu.Unlock()
+		gr.mu.RLock()
+		collected := gr.NextResourceID > 0
+		_, cached := gr.NodeCache[hostname]
+		gr.mu.RUnlock()
+
+		if !collected {
+			klog.V(3).Infof("CollectFromLister is not called.")
+			return
+		}
 
-		if nodeInfo, ok := gr.NodeCache[hostname]; !ok {
+		if !cached {
 			// normally, it is impossible to enter this part
-			klog.Warningf("Pod %s Namespace %s host %s, but host does not exist in cache", pod.Name, pod.Namespace, hostname)
+			klog.Warningf("Pod %s host %s, but host does not exist in cache", PodKey(pod), hostname)
 			/*
 				nodecache := NewEmptyNodeResInfo(hostname, gr.ResTypeMaxKind)
 				nodecache.AddPodToCache(pod, gr.ResTypeToID, ReserveSchedulerName)
 				gr.NodeCache[hostname] = nodecache
 			*/
-		} else {
-			podKey := pod.UID
-			if _, ok := nodeInfo.Pods[podKey]; !ok {
-				nodeInfo.AddPodToCache(pod, gr.ResTypeToID)
-			}
 		}
+
+		// the pod may be reserved on another node
+		gr.bindPod(pod, false)
+	}
+}
+
+// addBoundPod adds a pod which is not reserved before binding, the placeholder claimed by the pod
+// is taken over instead of counting the resources twice
+func (gr *GloalReserve) addBoundPod(nodeInfo *NodeResInfo, pod *v1.Pod) {
+	podReq := gr.podRequest(pod)
+	nodeInfo.claimPlaceholder(pod.Annotations[ClaimAnnotation], podReq)
+	nodeInfo.AddPodReqToCache(pod, podReq)
+	gr.setPodNode(pod.UID, nodeInfo.Name)
+}
+
+// updateBoundPod updates the phase and the requests of a pod cached on the node, a resize which
+// overcommits the node is reported
+func (gr *GloalReserve) updateBoundPod(nodeInfo *NodeResInfo, pod *v1.Pod) {
+	if over := nodeInfo.UpdatePodReq(pod, gr.podRequest(pod)); over != nil {
+		registerMetrics()
+		resizeOvercommits.Inc()
+		klog.Warningf("Pod %s is resized on node %s, the node is overcommitted by %v",
+			PodKey(pod), nodeInfo.Name, VectorToResourceList(over, gr.ResTypeToID))
 	}
 }
 
@@ -142,34 +205,74 @@ func (gr *GloalReserve) UpdatePod(oldObj, newObj interface{}) {
 		return
 	}
 
-	newHostname := newPod.Spec.NodeName
-	if len(newHostname) > 0 {
-		addFlag := false
-		gr.mu.Lock()
-		defer gr.mu.Unlock()
-
-		if oldHostName, ok := gr.PodToNode[newPod.UID]; !ok {
-			klog.Warningf("Pod %s namespace %s is not reserved by scheduler %s before binding",
-				newPod.Name, newPod.Namespace, newPod.Spec.SchedulerName)
-			gr.PodToNode[newPod.UID] = newHostname
-			addFlag = true
-		} else {
-			if oldHostName != newHostname {
-				// hostname is changed, move the old pod data into new host
-				addFlag = true
-				delete(gr.NodeCache[oldHostName].Pods, newPod.UID)
-			}
+	if len(newPod.Spec.NodeName) > 0 {
+		gr.bindPod(newPod, true)
+	}
+}
+
+// bindPod updates the bound pod by tryBindPod under the read lock, the pod may be reserved or
+// released by others between reading its node and locking the nodes. After bindPodRetries failed
+// tries, the pod is updated under the write lock where nobody else can move it.
+func (gr *GloalReserve) bindPod(pod *v1.Pod, warnUnreserved bool) {
+	gr.mu.RLock()
+	for i := 0; i < bindPodRetries; i++ {
+		if gr.tryBindPod(pod, warnUnreserved) {
+			gr.mu.RUnlock()
+			return
 		}
+	}
+	gr.mu.RUnlock()
 
-		//update state
-		if nodeCache, ok := gr.NodeCache[newHostname]; ok {
-			if addFlag {
-				nodeCache.AddPodToCache(newPod, gr.ResTypeToID)
-			} else {
-				nodeCache.UpdatePod(newPod, gr.ResTypeToID)
-			}
+	klog.V(3).Infof("Pod %s is moved during %d tries, bind it under the write lock", PodKey(pod), bindPodRetries)
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+	gr.tryBindPod(pod, warnUnreserved)
+}
+
+// tryBindPod locks the old and the new node of the bound pod and updates the pod, the pod is moved if
+// it is cached on another node. It returns false without doing anything if the old node of the pod
+// is changed before the nodes are locked.
+func (gr *GloalReserve) tryBindPod(pod *v1.Pod, warnUnreserved bool) bool {
+	newHostname := pod.Spec.NodeName
+	oldHostName, reserved := gr.podNode(pod.UID)
+
+	// the old node may be deleted, lock the nodes still in the cache
+	var nodeNames []string
+	for _, nodeName := range []string{newHostname, oldHostName} {
+		if _, ok := gr.NodeCache[nodeName]; ok {
+			nodeNames = append(nodeNames, nodeName)
 		}
 	}
+	nodes, _ := gr.lockNodes(nodeNames)
+	defer gr.unlockNodes(nodes)
+
+	if current, ok := gr.podNode(pod.UID); ok != reserved || current != oldHostName {
+		return false
+	}
+
+	nodeInfo, ok := gr.NodeCache[newHostname]
+	if !reserved {
+		if warnUnreserved {
+			klog.Warningf("Pod %s is not reserved by scheduler %s before binding",
+				PodKey(pod), pod.Spec.SchedulerName)
+		}
+	} else if oldHostName == newHostname && ok {
+		if _, cached := nodeInfo.Pods[pod.UID]; cached {
+			//update state, the pod may be resized in place
+			gr.updateBoundPod(nodeInfo, pod)
+			return true
+		}
+	} else if oldNode, cached := gr.NodeCache[oldHostName]; cached {
+		// hostname is changed, move the old pod data into new host
+		oldNode.removePod(pod.UID)
+	}
+
+	if ok {
+		gr.addBoundPod(nodeInfo, pod)
+	} else {
+		gr.deletePodNode(pod.UID)
+	}
+	return true
 }
 
 // DeletePod from GloalReserve
@@ -189,19 +292,31 @@ func (gr *GloalReserve) DeletePod(obj interface{}) {
 		klog.Errorf("cannot convert to *v1.Pod: %v", t)
 		return
 	}
-	klog.V(3).Infof("delete event for scheduled pod %s/%s ", pod.Namespace, pod.Name)
+	klog.V(3).Infof("delete event for scheduled pod %s ", PodKey(pod))
 	// NOTE: Updates must be written to scheduler cache before invalidating
 	// equivalence cache, because we could snapshot equivalence cache after the
 	// invalidation and then snapshot the cache itself. If the cache is
 	// snapshotted before updates are written, we would update equivalence
 	// cache with stale information which is based on snapshot of old cache.
-	delete(gr.PodToNode, pod.UID)
-	hostname := pod.Spec.NodeName
-	if len(hostname) > 0 {
-		gr.mu.Lock()
-		defer gr.mu.Unlock()
-		if nodecache, ok := gr.NodeCache[hostname]; ok {
-			nodecache.DeletePod(pod)
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	// a pod deleted before binding is only reserved on its indexed node
+	nodeNames := []string{}
+	indexed, _ := gr.podNode(pod.UID)
+	for _, nodeName := range []string{pod.Spec.NodeName, indexed} {
+		if _, ok := gr.NodeCache[nodeName]; ok {
+			nodeNames = append(nodeNames, nodeName)
 		}
 	}
+	nodes, _ := gr.lockNodes(nodeNames)
+	defer gr.unlockNodes(nodes)
+
+	for _, nodeInfo := range nodes {
+		nodeInfo.DeletePod(pod)
+		gr.deletePodNodeOn(pod.UID, nodeInfo.Name)
+	}
+	if _, ok := gr.NodeCache[indexed]; !ok {
+		gr.deletePodNodeOn(pod.UID, indexed)
+	}
 }
@@ -20,7 +20,9 @@ import (
 	"testing"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/metrics/legacyregistry"
 )
 
 func TestAddNode(t *testing.T) {
@@ -196,6 +198,81 @@ func TestUpdatePod(t *testing.T) {
 	})
 }
 
+func TestUpdatePodResize(t *testing.T) {
+	pod0 := GetPod("pod0", "1", "1000", "node0", v1.PodRunning)
+	gr := InitGR([]*v1.Node{GetNode0()}, []*v1.Pod{pod0}, true)
+	gr.setPodNode(pod0.UID, "node0")
+	nodeInfo := gr.NodeCache["node0"]
+	cpu := gr.ResTypeToID[v1.ResourceCPU]
+
+	t.Run("UpdatePodResize up", func(t *testing.T) {
+		gr.UpdatePod(nil, GetPod("pod0", "1500m", "1000", "node0", v1.PodRunning))
+		if nodeInfo.Pods[pod0.UID].Resources[cpu] != 1500 || nodeInfo.Requested[cpu] != 1500 {
+			t.Errorf("resize up failed: %v", nodeInfo.Requested)
+		}
+	})
+
+	t.Run("UpdatePodResize down", func(t *testing.T) {
+		gr.UpdatePod(nil, GetPod("pod0", "500m", "1000", "node0", v1.PodRunning))
+		if nodeInfo.Pods[pod0.UID].Resources[cpu] != 500 || nodeInfo.Requested[cpu] != 500 {
+			t.Errorf("resize down failed: %v", nodeInfo.Requested)
+		}
+	})
+
+	t.Run("UpdatePodResize overcommit", func(t *testing.T) {
+		before := counterValue("globalreserve_resize_overcommits_total")
+		gr.UpdatePod(nil, GetPod("pod0", "3", "1000", "node0", v1.PodRunning))
+		if counterValue("globalreserve_resize_overcommits_total") != before+1 {
+			t.Errorf("overcommit failed, the resize is not reported")
+		}
+		if nodeInfo.Requested[cpu] != 3000 || nodeInfo.CheckUsage() != nil {
+			t.Errorf("overcommit failed, the resize is not counted: %v", nodeInfo.Requested)
+		}
+	})
+
+	t.Run("UpdatePodResize finished pod", func(t *testing.T) {
+		before := counterValue("globalreserve_resize_overcommits_total")
+		gr.UpdatePod(nil, GetPod("pod0", "4", "1000", "node0", v1.PodSucceeded))
+		if counterValue("globalreserve_resize_overcommits_total") != before || nodeInfo.Requested[cpu] != 0 {
+			t.Errorf("finished pod failed: %v", nodeInfo.Requested)
+		}
+	})
+
+	t.Run("UpdatePodResize configured extractor", func(t *testing.T) {
+		gr.PodRequests, _ = GetPodRequestExtractor("limits")
+		defer func() { gr.PodRequests = nil }()
+
+		resized := GetPod("pod0", "500m", "1000", "node0", v1.PodRunning)
+		resized.Spec.Containers[0].Resources.Limits = v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}
+		gr.UpdatePod(nil, resized)
+		if nodeInfo.Pods[pod0.UID].Resources[cpu] != 1000 {
+			t.Errorf("configured extractor failed: %v", nodeInfo.Pods[pod0.UID].Resources)
+		}
+	})
+
+	t.Run("UpdatePodResize reserved pod", func(t *testing.T) {
+		pod1 := GetPod("pod1", "100m", "100", "", v1.PodPending)
+		if ret := gr.Reserve(pod1, "node0"); len(ret) > 0 {
+			t.Fatalf("reserve failed: %s", ret)
+		}
+		nodeInfo.UpdatePodReq(pod1, gr.podRequest(GetPod("pod1", "200m", "100", "", v1.PodPending)))
+		if podInfo := nodeInfo.Pods[pod1.UID]; podInfo.State != ReservedState || podInfo.Resources[cpu] != 200 {
+			t.Errorf("reserved pod failed, the pod is %s", podInfo.State)
+		}
+	})
+}
+
+// counterValue returns the value of the counter registered in the legacyregistry, 0 if it is not registered
+func counterValue(name string) float64 {
+	families, _ := legacyregistry.DefaultGatherer.Gather()
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
 func TestDeletePod(t *testing.T) {
 	pod0 := GetPod("pod0", "1000m", "1000", "node0", v1.PodPending)
 	node0 := GetNode0()
@@ -0,0 +1,254 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog"
+)
+
+// DefaultExtractorName is the name of the default PodRequestExtractor and NodeCapacityExtractor
+const DefaultExtractorName string = "default"
+
+// PodRequestExtractor translates a pod into the resources reserved for it
+type PodRequestExtractor interface {
+	PodRequests(pod *v1.Pod) v1.ResourceList
+}
+
+// NodeCapacityExtractor translates a node into the resources it provides
+type NodeCapacityExtractor interface {
+	NodeCapacity(node *v1.Node) v1.ResourceList
+}
+
+// PodRequestFunc is a function implementing PodRequestExtractor
+type PodRequestFunc func(pod *v1.Pod) v1.ResourceList
+
+// PodRequests calls f(pod)
+func (f PodRequestFunc) PodRequests(pod *v1.Pod) v1.ResourceList {
+	return f(pod)
+}
+
+// NodeCapacityFunc is a function implementing NodeCapacityExtractor
+type NodeCapacityFunc func(node *v1.Node) v1.ResourceList
+
+// NodeCapacity calls f(node)
+func (f NodeCapacityFunc) NodeCapacity(node *v1.Node) v1.ResourceList {
+	return f(node)
+}
+
+var (
+	extractorMu sync.RWMutex
+	// registered extractors, selected by GRConf.PodRequestExtractor and GRConf.NodeCapacityExtractor
+	podRequestExtractors = map[string]PodRequestExtractor{
+		DefaultExtractorName: PodRequestFunc(DefaultPodRequests),
+		"limits":             PodRequestFunc(LimitsPodRequests),
+	}
+	nodeCapacityExtractors = map[string]NodeCapacityExtractor{
+		DefaultExtractorName: NodeCapacityFunc(AllocatableCapacity),
+	}
+)
+
+// RegisterPodRequestExtractor registers a PodRequestExtractor which can be selected by name in GRConf,
+// it must be called before the plugin is created, e.g. in main()
+func RegisterPodRequestExtractor(name string, extractor PodRequestExtractor) {
+	extractorMu.Lock()
+	defer extractorMu.Unlock()
+	podRequestExtractors[name] = extractor
+}
+
+// RegisterNodeCapacityExtractor registers a NodeCapacityExtractor which can be selected by name in GRConf,
+// it must be called before the plugin is created, e.g. in main()
+func RegisterNodeCapacityExtractor(name string, extractor NodeCapacityExtractor) {
+	extractorMu.Lock()
+	defer extractorMu.Unlock()
+	nodeCapacityExtractors[name] = extractor
+}
+
+// GetPodRequestExtractor returns the registered PodRequestExtractor, empty name returns the default one
+func GetPodRequestExtractor(name string) (PodRequestExtractor, error) {
+	if len(name) == 0 {
+		name = DefaultExtractorName
+	}
+
+	extractorMu.RLock()
+	defer extractorMu.RUnlock()
+	if extractor, ok := podRequestExtractors[name]; ok {
+		return extractor, nil
+	}
+	return nil, fmt.Errorf("pod request extractor %q is not registered", name)
+}
+
+// GetNodeCapacityExtractor returns the registered NodeCapacityExtractor, empty name returns the default one
+func GetNodeCapacityExtractor(name string) (NodeCapacityExtractor, error) {
+	if len(name) == 0 {
+		name = DefaultExtractorName
+	}
+
+	extractorMu.RLock()
+	defer extractorMu.RUnlock()
+	if extractor, ok := nodeCapacityExtractors[name]; ok {
+		return extractor, nil
+	}
+	return nil, fmt.Errorf("node capacity extractor %q is not registered", name)
+}
+
+// DefaultPodRequests sums the container requests, every pod also takes one v1.ResourcePods
+func DefaultPodRequests(pod *v1.Pod) v1.ResourceList {
+	reqs := v1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResourceList(reqs, container.Resources.Requests)
+	}
+	reqs[v1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+
+	return reqs
+}
+
+// LimitsPodRequests sums the container limits, the requests are used for the resources without limits
+func LimitsPodRequests(pod *v1.Pod) v1.ResourceList {
+	reqs := v1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		containerReqs := container.Resources.Requests.DeepCopy()
+		if containerReqs == nil {
+			containerReqs = v1.ResourceList{}
+		}
+		for name, quantity := range container.Resources.Limits {
+			containerReqs[name] = quantity
+		}
+		addResourceList(reqs, containerReqs)
+	}
+	reqs[v1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+
+	return reqs
+}
+
+// AllocatableCapacity returns the node allocatable resources
+func AllocatableCapacity(node *v1.Node) v1.ResourceList {
+	return node.Status.Allocatable
+}
+
+// ExtractPodRequests returns the requests of the pod by podRequests, nil means DefaultPodRequests,
+// together with the extra resources of the extractors. It is what GloalReserve reserves for the pod.
+func ExtractPodRequests(pod *v1.Pod, podRequests PodRequestExtractor, extractors []ResourceExtractor) v1.ResourceList {
+	if podRequests == nil {
+		podRequests = PodRequestFunc(DefaultPodRequests)
+	}
+	reqs := v1.ResourceList{}
+	for resName, quantity := range podRequests.PodRequests(pod) {
+		reqs[resName] = quantity
+	}
+	for _, extractor := range extractors {
+		for resName, quantity := range extractor.PodResources(pod) {
+			reqs[resName] = quantity
+		}
+	}
+	return reqs
+}
+
+// ResourceExtractor derives extra reservable resources from pods and nodes, the extra resources
+// are appended to the resource vectors and enforced the same way as the native resources
+type ResourceExtractor interface {
+	// PodResources returns the extra resources requested by the pod
+	PodResources(pod *v1.Pod) v1.ResourceList
+	// NodeResources returns the extra resources provided by the node
+	NodeResources(node *v1.Node) v1.ResourceList
+}
+
+// SharedResourceConf describes a shared device resource whose usage is expressed by annotations,
+// e.g. the GPU memory slices requested by a pod
+type SharedResourceConf struct {
+	// resource name used in the resource vectors
+	Name v1.ResourceName `json:"name"`
+	// pod annotation holding the requested amount, it is preferred to PodLabel
+	PodAnnotation string `json:"podAnnotation,omitempty"`
+	// pod label holding the requested amount
+	PodLabel string `json:"podLabel,omitempty"`
+	// node annotation holding the capacity
+	NodeAnnotation string `json:"nodeAnnotation"`
+}
+
+// AnnotationExtractor reads shared device resources from pod annotations or labels and node annotations.
+// The values are quantities like "0.5" or "2Gi", they are saved in milli units so fractions are kept.
+type AnnotationExtractor struct {
+	Resources []SharedResourceConf
+}
+
+var _ ResourceExtractor = &AnnotationExtractor{}
+
+// NewAnnotationExtractor creates an AnnotationExtractor
+func NewAnnotationExtractor(resources []SharedResourceConf) *AnnotationExtractor {
+	return &AnnotationExtractor{
+		Resources: resources,
+	}
+}
+
+// PodResources returns the shared resources requested by the pod
+func (ae *AnnotationExtractor) PodResources(pod *v1.Pod) v1.ResourceList {
+	reqs := v1.ResourceList{}
+	for _, res := range ae.Resources {
+		value, ok := "", false
+		if len(res.PodAnnotation) > 0 {
+			value, ok = pod.Annotations[res.PodAnnotation]
+		}
+		if !ok && len(res.PodLabel) > 0 {
+			value, ok = pod.Labels[res.PodLabel]
+		}
+		if !ok {
+			continue
+		}
+
+		if quantity, ok := parseMilliQuantity(value); ok {
+			reqs[res.Name] = quantity
+		} else {
+			klog.Errorf("Pod %s requests an invalid %s: %s", PodKey(pod), res.Name, value)
+		}
+	}
+
+	return reqs
+}
+
+// NodeResources returns the shared resources provided by the node
+func (ae *AnnotationExtractor) NodeResources(node *v1.Node) v1.ResourceList {
+	capa := v1.ResourceList{}
+	for _, res := range ae.Resources {
+		value, ok := node.Annotations[res.NodeAnnotation]
+		if !ok {
+			continue
+		}
+
+		if quantity, ok := parseMilliQuantity(value); ok {
+			capa[res.Name] = quantity
+		} else {
+			klog.Errorf("Node %s provides an invalid %s: %s", node.Name, res.Name, value)
+		}
+	}
+
+	return capa
+}
+
+// parseMilliQuantity parses the value and returns its milli value as an integer quantity
+func parseMilliQuantity(value string) (resource.Quantity, bool) {
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return resource.Quantity{}, false
+	}
+
+	return *resource.NewQuantity(quantity.MilliValue(), resource.DecimalSI), true
+}
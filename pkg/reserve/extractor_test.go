@@ -0,0 +1,181 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const gpuMem v1.ResourceName = "example.com/gpu-mem"
+
+func getGPUExtractor() *AnnotationExtractor {
+	return NewAnnotationExtractor([]SharedResourceConf{
+		{
+			Name:           gpuMem,
+			PodAnnotation:  "example.com/gpu-mem",
+			PodLabel:       "gpu-mem",
+			NodeAnnotation: "example.com/gpu-mem-capacity",
+		},
+	})
+}
+
+func TestAnnotationExtractor(t *testing.T) {
+	ae := getGPUExtractor()
+
+	t.Run("AnnotationExtractor pod annotation", func(t *testing.T) {
+		pod := GetPod("pod0", "1", "1000", "", v1.PodPending)
+		pod.Annotations = map[string]string{"example.com/gpu-mem": "0.5"}
+		reqs := ae.PodResources(pod)
+		value := reqs[gpuMem]
+		if len(reqs) != 1 || value.Value() != 500 {
+			t.Errorf("pod annotation failed")
+		}
+	})
+
+	t.Run("AnnotationExtractor pod label", func(t *testing.T) {
+		pod := GetPod("pod0", "1", "1000", "", v1.PodPending)
+		pod.Labels = map[string]string{"gpu-mem": "2"}
+		reqs := ae.PodResources(pod)
+		value := reqs[gpuMem]
+		if len(reqs) != 1 || value.Value() != 2000 {
+			t.Errorf("pod label failed")
+		}
+	})
+
+	t.Run("AnnotationExtractor invalid pod annotation", func(t *testing.T) {
+		pod := GetPod("pod0", "1", "1000", "", v1.PodPending)
+		pod.Annotations = map[string]string{"example.com/gpu-mem": "half"}
+		if len(ae.PodResources(pod)) != 0 {
+			t.Errorf("invalid pod annotation failed")
+		}
+	})
+
+	t.Run("AnnotationExtractor node annotation", func(t *testing.T) {
+		node := GetNode0()
+		node.Annotations = map[string]string{"example.com/gpu-mem-capacity": "4"}
+		capa := ae.NodeResources(node)
+		value := capa[gpuMem]
+		if len(capa) != 1 || value.Value() != 4000 {
+			t.Errorf("node annotation failed")
+		}
+	})
+}
+
+func TestReserveSharedResource(t *testing.T) {
+	node0 := GetNode0()
+	node0.Annotations = map[string]string{"example.com/gpu-mem-capacity": "1"}
+
+	gr := InitGR([]*v1.Node{node0}, nil, false)
+	gr.Extractors = []ResourceExtractor{getGPUExtractor()}
+	gr.CollectFromLister()
+
+	pod0 := GetPod("pod0", "100m", "100", "node0", v1.PodPending)
+	pod0.Annotations = map[string]string{"example.com/gpu-mem": "0.5"}
+	pod1 := GetPod("pod1", "100m", "100", "node0", v1.PodPending)
+	pod1.Annotations = map[string]string{"example.com/gpu-mem": "0.5"}
+	pod2 := GetPod("pod2", "100m", "100", "node0", v1.PodPending)
+	pod2.Annotations = map[string]string{"example.com/gpu-mem": "0.25"}
+
+	t.Run("Reserve shared resource registered", func(t *testing.T) {
+		gpuIndex, ok := gr.ResTypeToID[gpuMem]
+		if !ok || gr.NodeCache["node0"].Capa[gpuIndex] != 1000 {
+			t.Errorf("shared resource registered failed")
+		}
+	})
+
+	t.Run("Reserve shared resource success", func(t *testing.T) {
+		ret := gr.ReservePods([]*v1.Pod{pod0, pod1}, []string{"node0", "node0"})
+		if len(ret.Error) > 0 {
+			t.Errorf("Reserve shared resource success failed")
+		}
+	})
+
+	t.Run("Reserve shared resource overcommit", func(t *testing.T) {
+		ret := gr.Reserve(pod2, "node0")
+		if len(ret) == 0 || len(gr.NodeCache["node0"].Pods) != 2 {
+			t.Errorf("Reserve shared resource overcommit failed")
+		}
+	})
+}
+
+func TestRegisterExtractor(t *testing.T) {
+	t.Run("Extractor default", func(t *testing.T) {
+		podReqs, err1 := GetPodRequestExtractor("")
+		nodeCapa, err2 := GetNodeCapacityExtractor("")
+		if err1 != nil || err2 != nil || podReqs == nil || nodeCapa == nil {
+			t.Errorf("default extractor failed")
+		}
+	})
+
+	t.Run("Extractor not registered", func(t *testing.T) {
+		_, err1 := GetPodRequestExtractor("not-registered")
+		_, err2 := GetNodeCapacityExtractor("not-registered")
+		if err1 == nil || err2 == nil {
+			t.Errorf("extractor not registered failed")
+		}
+	})
+
+	t.Run("Extractor registered", func(t *testing.T) {
+		RegisterNodeCapacityExtractor("half", NodeCapacityFunc(func(node *v1.Node) v1.ResourceList {
+			capa := v1.ResourceList{}
+			for name, quantity := range node.Status.Allocatable {
+				capa[name] = *resource.NewQuantity(quantity.Value()/2, resource.DecimalSI)
+			}
+			return capa
+		}))
+
+		gr := InitGR([]*v1.Node{GetNode0()}, nil, false)
+		if err := gr.Configure(&GRConf{NodeCapacityExtractor: "half"}); err != nil {
+			t.Errorf("extractor registered failed with %s", err.Error())
+		}
+		gr.CollectFromLister()
+		if gr.NodeCache["node0"].Capa[gr.ResTypeToID[v1.ResourceMemory]] != 2500 {
+			t.Errorf("extractor registered failed")
+		}
+	})
+}
+
+func TestLimitsPodRequests(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0()}, nil, false)
+	gr.Configure(&GRConf{PodRequestExtractor: "limits"})
+	gr.CollectFromLister()
+
+	pod0 := GetPod("pod0", "500m", "1000", "node0", v1.PodPending)
+	pod0.Spec.Containers[0].Resources.Limits = v1.ResourceList{
+		v1.ResourceCPU: resource.MustParse("2"),
+	}
+	pod1 := GetPod("pod1", "500m", "1000", "node0", v1.PodPending)
+
+	t.Run("LimitsPodRequests reserve by limits", func(t *testing.T) {
+		ret := gr.Reserve(pod0, "node0")
+		podInfo := gr.NodeCache["node0"].Pods[pod0.UID]
+		if len(ret) > 0 || podInfo.Resources[gr.ResTypeToID[v1.ResourceCPU]] != 2000 ||
+			podInfo.Resources[gr.ResTypeToID[v1.ResourceMemory]] != 1000 {
+			t.Errorf("reserve by limits failed")
+		}
+	})
+
+	t.Run("LimitsPodRequests reserve error", func(t *testing.T) {
+		ret := gr.Reserve(pod1, "node0")
+		if len(ret) == 0 {
+			t.Errorf("reserve error failed")
+		}
+	})
+}
@@ -0,0 +1,133 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	framework "k8s.io/kubernetes/pkg/scheduler/framework/v1alpha1"
+)
+
+// GangLabel is the pod label naming the gang of the pod
+const GangLabel string = "globalreserve.ibm.com/gang"
+
+// GangSizeAnnotation is the pod annotation with the number of pods in the gang
+const GangSizeAnnotation string = "globalreserve.ibm.com/gang-size"
+
+// DefaultGangTimeout is used when GRConf.GangTimeoutSeconds is not specified
+const DefaultGangTimeout = 60 * time.Second
+
+// GetPodGang returns the gang key and size of the pod, empty key if the pod is not in a gang
+func GetPodGang(pod *v1.Pod) (string, int) {
+	name, ok := pod.Labels[GangLabel]
+	if !ok || len(name) == 0 {
+		return "", 0
+	}
+
+	size, err := strconv.Atoi(pod.Annotations[GangSizeAnnotation])
+	if err != nil || size < 1 {
+		klog.Warningf("Pod %s has invalid %s %q, it is not scheduled as a gang", PodKey(pod), GangSizeAnnotation,
+			pod.Annotations[GangSizeAnnotation])
+		return "", 0
+	}
+
+	return pod.Namespace + "/" + name, size
+}
+
+// waitingPodGetter is the part of framework.FrameworkHandle used by gangTracker
+type waitingPodGetter interface {
+	GetWaitingPod(uid types.UID) framework.WaitingPod
+}
+
+// gangMember is a gang pod waiting at permit
+type gangMember struct {
+	pod      *v1.Pod
+	nodeName string
+}
+
+// gangTracker collects the gang pods waiting at permit until all members arrive
+type gangTracker struct {
+	mu    sync.Mutex
+	gangs map[string]map[types.UID]*gangMember // key: gang key, pod uid
+}
+
+func newGangTracker() *gangTracker {
+	return &gangTracker{gangs: make(map[string]map[types.UID]*gangMember)}
+}
+
+// add saves the pod into its gang, it returns all members and removes the gang when the gang is complete
+func (gt *gangTracker) add(gang string, size int, pod *v1.Pod, nodeName string) []*gangMember {
+	gt.mu.Lock()
+	defer gt.mu.Unlock()
+
+	members, ok := gt.gangs[gang]
+	if !ok {
+		members = make(map[types.UID]*gangMember)
+		gt.gangs[gang] = members
+	}
+	members[pod.UID] = &gangMember{pod: pod, nodeName: nodeName}
+	if len(members) < size {
+		return nil
+	}
+
+	delete(gt.gangs, gang)
+	result := make([]*gangMember, 0, len(members))
+	for _, member := range members {
+		result = append(result, member)
+	}
+	return result
+}
+
+// remove deletes the whole gang if the pod is waiting in it, it returns the other waiting members
+func (gt *gangTracker) remove(gang string, uid types.UID) []*gangMember {
+	gt.mu.Lock()
+	defer gt.mu.Unlock()
+
+	members, ok := gt.gangs[gang]
+	if !ok {
+		return nil
+	}
+	if _, ok := members[uid]; !ok {
+		return nil
+	}
+
+	delete(gt.gangs, gang)
+	result := make([]*gangMember, 0, len(members))
+	for memberUID, member := range members {
+		if memberUID != uid {
+			result = append(result, member)
+		}
+	}
+	return result
+}
+
+// getWaitingPod returns the waiting pod, the framework adds a pod into its waiting pods just after
+// Permit returns, so a member arriving at the same time may not be found at once
+func getWaitingPod(handle waitingPodGetter, uid types.UID) framework.WaitingPod {
+	for i := 0; i < 100; i++ {
+		if wp := handle.GetWaitingPod(uid); wp != nil {
+			return wp
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	framework "k8s.io/kubernetes/pkg/scheduler/framework/v1alpha1"
+)
+
+// fakeWaitingPod records the signals sent to a pod waiting at permit
+type fakeWaitingPod struct {
+	pod      *v1.Pod
+	allowed  bool
+	rejected bool
+}
+
+func (wp *fakeWaitingPod) GetPod() *v1.Pod              { return wp.pod }
+func (wp *fakeWaitingPod) GetPendingPlugins() []string  { return []string{Name} }
+func (wp *fakeWaitingPod) Allow(pluginName string) bool { wp.allowed = true; return true }
+func (wp *fakeWaitingPod) Reject(msg string) bool       { wp.rejected = true; return true }
+
+// fakeWaitingPods simulates the waiting pods of the framework
+type fakeWaitingPods map[types.UID]*fakeWaitingPod
+
+func (f fakeWaitingPods) GetWaitingPod(uid types.UID) framework.WaitingPod {
+	if wp, ok := f[uid]; ok {
+		return wp
+	}
+	return nil
+}
+
+// GetGangPod returns a pod in the gang
+func GetGangPod(name string, cpuStr string, nodename string, gang string, size int) *v1.Pod {
+	pod := GetPod(name, cpuStr, "100", nodename, v1.PodPending)
+	pod.Labels = map[string]string{GangLabel: gang}
+	pod.Annotations = map[string]string{GangSizeAnnotation: strconv.Itoa(size)}
+	return pod
+}
+
+func TestGetPodGang(t *testing.T) {
+	t.Run("GetPodGang not in gang", func(t *testing.T) {
+		if gang, _ := GetPodGang(GetPod("pod0", "1", "100", "", v1.PodPending)); len(gang) > 0 {
+			t.Errorf("not in gang failed")
+		}
+	})
+
+	t.Run("GetPodGang invalid size", func(t *testing.T) {
+		pod := GetGangPod("pod0", "1", "", "gang0", 2)
+		pod.Annotations[GangSizeAnnotation] = "two"
+		if gang, _ := GetPodGang(pod); len(gang) > 0 {
+			t.Errorf("invalid size failed")
+		}
+	})
+
+	t.Run("GetPodGang success", func(t *testing.T) {
+		if gang, size := GetPodGang(GetGangPod("pod0", "1", "", "gang0", 2)); gang != "NS1/gang0" || size != 2 {
+			t.Errorf("success failed")
+		}
+	})
+}
+
+func TestPluginPermit(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0(), GetNode1()}, nil, true)
+	waitingPods := make(fakeWaitingPods)
+	plugin := &GlobalReservePlugin{
+		ReserveImpl:    gr,
+		GangScheduling: true,
+		GangTimeout:    time.Second,
+		handle:         waitingPods,
+		gangs:          newGangTracker(),
+	}
+
+	// permit runs the pod and records it as waiting if the plugin asks to wait
+	permit := func(pod *v1.Pod, nodeName string) *framework.Status {
+		state := framework.NewCycleState()
+		if status := plugin.Reserve(context.TODO(), state, pod, nodeName); !status.IsSuccess() {
+			return status
+		}
+		status, timeout := plugin.Permit(context.TODO(), state, pod, nodeName)
+		if status.Code() == framework.Wait && timeout == time.Second {
+			waitingPods[pod.UID] = &fakeWaitingPod{pod: pod}
+		}
+		return status
+	}
+
+	t.Run("PluginPermit non-gang pod", func(t *testing.T) {
+		pod := GetPod("pod0", "100m", "100", "node0", v1.PodPending)
+		if status := permit(pod, "node0"); !status.IsSuccess() || len(gr.NodeCache["node0"].Pods) != 1 {
+			t.Errorf("non-gang pod failed")
+		}
+		plugin.Unreserve(context.TODO(), nil, pod, "node0")
+	})
+
+	t.Run("PluginPermit gang success", func(t *testing.T) {
+		pod0 := GetGangPod("pod0", "1", "node0", "gang0", 2)
+		pod1 := GetGangPod("pod1", "1", "node0", "gang0", 2)
+		if status := permit(pod0, "node0"); status.Code() != framework.Wait || len(gr.NodeCache["node0"].Pods) != 0 {
+			t.Errorf("gang waits failed")
+		}
+		if status := permit(pod1, "node0"); !status.IsSuccess() || !waitingPods[pod0.UID].allowed ||
+			len(gr.NodeCache["node0"].Pods) != 2 {
+			t.Errorf("gang success failed")
+		}
+	})
+
+	t.Run("PluginPermit gang rejected together", func(t *testing.T) {
+		pod2 := GetGangPod("pod2", "1500m", "node1", "gang1", 2)
+		pod3 := GetGangPod("pod3", "1500m", "node1", "gang1", 2)
+		permit(pod2, "node1")
+		if status := permit(pod3, "node1"); status.Code() != framework.Unschedulable || !waitingPods[pod2.UID].rejected ||
+			len(gr.NodeCache["node1"].Pods) != 0 {
+			t.Errorf("gang rejected together failed")
+		}
+	})
+
+	t.Run("PluginPermit gang timeout", func(t *testing.T) {
+		pod4 := GetGangPod("pod4", "100m", "node1", "gang2", 3)
+		pod5 := GetGangPod("pod5", "100m", "node1", "gang2", 3)
+		permit(pod4, "node1")
+		permit(pod5, "node1")
+		// the framework unreserves pod4 when it times out
+		plugin.Unreserve(context.TODO(), nil, pod4, "node1")
+		if !waitingPods[pod5.UID].rejected || len(plugin.gangs.gangs) != 0 || len(gr.NodeCache["node1"].Pods) != 0 {
+			t.Errorf("gang timeout failed")
+		}
+	})
+}
@@ -17,14 +17,17 @@
 package reserve
 
 import (
-	"log"
-	"net/http"
+	"context"
+	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/julienschmidt/httprouter"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
 	framework "k8s.io/kubernetes/pkg/scheduler/framework/v1alpha1"
@@ -33,44 +36,133 @@ import (
 
 //GloalReserve used for saving all infomation
 type GloalReserve struct {
-	mu             sync.RWMutex
-	ResTypeToID    map[v1.ResourceName]int         //key: resource type, value: index
-	ResTypeMaxKind int                             //the max number of resource types
-	NextResourceID int                             //index when new resource type is added
-	NodeCache      map[string]*NodeResInfo         //global cache, key: node name, value: NodeResInfo
-	PodToNode      map[types.UID]string            //key: pod uid, value: binding host
-	NodeLister     schedulerlisters.NodeInfoLister //listing all pods when starting
-	PodLister      schedulerlisters.PodLister      //listing all nodes when starting
+	mu                 sync.RWMutex                    //see nodelock.go
+	podMu              sync.Mutex                      //guards PodToNode when mu is read locked
+	ResTypeToID        map[v1.ResourceName]int         //key: resource type, value: index
+	ResTypeMaxKind     int                             //the max number of resource types
+	NextResourceID     int                             //index when new resource type is added
+	NodeCache          map[string]*NodeResInfo         //global cache, key: node name, value: NodeResInfo
+	PodToNode          map[types.UID]string            //key: pod uid, value: binding host
+	NodeLister         schedulerlisters.NodeInfoLister //listing all pods when starting
+	PodLister          schedulerlisters.PodLister      //listing all nodes when starting
+	PodRequests        PodRequestExtractor             //translates pods into requests, nil means DefaultPodRequests
+	NodeCapacities     NodeCapacityExtractor           //translates nodes into capacity, nil means AllocatableCapacity
+	Extractors         []ResourceExtractor             //extra reservable resources besides the native ones
+	Defaults           *NodePool                       //cluster wide settings like overcommit and headroom
+	NodePools          []*NodePool                     //node pools overriding the cluster wide settings
+	Bookings           map[string]*bookingInfo         //key: booking id, value: resources held for a time window
+	PlacementStrategy  string                          //default strategy of PlacePods
+	ReservationTTL     time.Duration                   //reserved pods not bound in time are released, 0 means never
+	PlaceholderTTL     time.Duration                   //TTL of the placeholders not specifying it, 0 means DefaultPlaceholderTTL
+	ResourceTypeBuffer int                             //number of resource types can be added after collecting, 0 means ResourceTypeBuffer
+	Quotas             map[string]v1.ResourceList      //key: scheduler name, value: resources the scheduler can reserve in total
+	ConsistencyCheck   bool                            //recompute the totals of the nodes after every change, for debugging
+	ReconcileInterval  time.Duration                   //how often the cache is reconciled with the informers, 0 means never
+
+	server         *ReserveServer //http server started by NewLocalReserve
+	stopped        int32          //set by Shutdown, the informer events are ignored after it
+	reconciler     *Reconciler    //created by getReconciler if it is not created with the informers
+	reconcilerOnce sync.Once
+	reconcileStop  chan struct{} //stops the reconciler started by NewLocalReserve
 }
 
 var _ GlobalReserverInterface = &GloalReserve{}
 
 //NewLocalReserve return a GloalReserve with can works with k8s default scheduler plugin
-func NewLocalReserve(handler framework.FrameworkHandle, listeningPort string) (GlobalReserverInterface, error) {
-	gr := &GloalReserve{
+func NewLocalReserve(handler framework.FrameworkHandle, conf *GRConf) (GlobalReserverInterface, error) {
+	gr := newGloalReserve(handler.SnapshotSharedLister().NodeInfos(), handler.SnapshotSharedLister().Pods())
+
+	if err := gr.Configure(conf); err != nil {
+		return nil, err
+	}
+
+	listenAddress := conf.ListenAddress
+	if len(listenAddress) == 0 {
+		listeningPort := DefaultListeningPort
+		if conf.Port > 1024 && conf.Port < 65535 {
+			listeningPort = strconv.Itoa(conf.Port)
+		}
+		listenAddress = ":" + listeningPort
+	}
+
+	// start the http server to receive 3rd party reserve request, the plugin fails if it can not listen
+	server, err := StartHTTPServer(gr, listenAddress, conf.TLS)
+	if err != nil {
+		return nil, err
+	}
+	gr.server = server
+
+	factory := handler.SharedInformerFactory()
+	gr.AddEventHandlers(factory)
+
+	// the snapshot of the scheduler is only updated when scheduling, reconcile with the informers
+	gr.reconciler = NewReconciler(gr, NewInformerNodeInfoLister(factory.Core().V1().Nodes().Lister()),
+		NewInformerPodLister(factory.Core().V1().Pods().Lister()), gr.ReconcileInterval)
+	if gr.ReconcileInterval > 0 {
+		gr.reconcileStop = make(chan struct{})
+		go gr.reconciler.Run(gr.reconcileStop)
+	}
+
+	localReserves.mu.Lock()
+	localReserves.reserves = append(localReserves.reserves, gr)
+	localReserves.mu.Unlock()
+
+	return gr, nil
+}
+
+// NewInformerReserve returns a GloalReserve fed by the informers of factory without a scheduler, the
+// caller starts the informers and calls Collect after they are synced
+func NewInformerReserve(factory informers.SharedInformerFactory, conf *GRConf) (*GloalReserve, error) {
+	gr := newGloalReserve(NewInformerNodeInfoLister(factory.Core().V1().Nodes().Lister()),
+		NewInformerPodLister(factory.Core().V1().Pods().Lister()))
+
+	if err := gr.Configure(conf); err != nil {
+		return nil, err
+	}
+
+	gr.AddEventHandlers(factory)
+	gr.reconciler = NewReconciler(gr, gr.NodeLister, gr.PodLister, gr.ReconcileInterval)
+
+	return gr, nil
+}
+
+func newGloalReserve(nodeLister schedulerlisters.NodeInfoLister, podLister schedulerlisters.PodLister) *GloalReserve {
+	return &GloalReserve{
 		ResTypeToID:    make(map[v1.ResourceName]int),
 		ResTypeMaxKind: 0,
 		NextResourceID: 0,
 		NodeCache:      make(map[string]*NodeResInfo),
 		PodToNode:      make(map[types.UID]string),
-		NodeLister:     handler.SnapshotSharedLister().NodeInfos(),
-		PodLister:      handler.SnapshotSharedLister().Pods(),
+		NodeLister:     nodeLister,
+		PodLister:      podLister,
 	}
+}
 
+// AddEventHandlers keeps the cache up to date with the node and pod informers of factory
+func (gr *GloalReserve) AddEventHandlers(factory informers.SharedInformerFactory) {
 	// add node event handlers, add/delete node into/from cache
-	handler.SharedInformerFactory().Core().V1().Nodes().Informer().AddEventHandler(
-		cache.ResourceEventHandlerFuncs{
-			AddFunc:    gr.AddNode,
-			UpdateFunc: gr.UpdateNode,
-			DeleteFunc: gr.DeleteNode,
+	factory.Core().V1().Nodes().Informer().AddEventHandler(
+		cache.FilteringResourceEventHandler{
+			// the handlers can not be removed from the informers, ignore the events after Shutdown
+			FilterFunc: func(obj interface{}) bool {
+				return !gr.isStopped()
+			},
+			Handler: cache.ResourceEventHandlerFuncs{
+				AddFunc:    gr.AddNode,
+				UpdateFunc: gr.UpdateNode,
+				DeleteFunc: gr.DeleteNode,
+			},
 		},
 	)
 
 	// add pod event handlers, add/delete pod into/from cache
-	handler.SharedInformerFactory().Core().V1().Pods().Informer().AddEventHandler(
+	factory.Core().V1().Pods().Informer().AddEventHandler(
 		cache.FilteringResourceEventHandler{
 			// does not handle non-binding pod
 			FilterFunc: func(obj interface{}) bool {
+				if gr.isStopped() {
+					return false
+				}
 				switch t := obj.(type) {
 				case *v1.Pod:
 					return assignedPod(t)
@@ -92,19 +184,85 @@ func NewLocalReserve(handler framework.FrameworkHandle, listeningPort string) (G
 			},
 		},
 	)
+}
 
-	// start the http server to receive 3rd party reserve request
-	router := httprouter.New()
-	router.POST(ReserveHTTPPathPrefix, AddReserveRoute(gr))
-	router.POST(UnreserveHTTPPathPrefix, AddUnreserveRoute(gr))
+// Shutdown ignores the informer events from now on and stops the http server started by
+// NewLocalReserve, it waits until the in-flight requests are done or ctx is done
+func (gr *GloalReserve) Shutdown(ctx context.Context) error {
+	if atomic.CompareAndSwapInt32(&gr.stopped, 0, 1) && gr.reconcileStop != nil {
+		close(gr.reconcileStop)
+	}
+	if gr.server == nil {
+		return nil
+	}
+	return gr.server.Shutdown(ctx)
+}
 
-	klog.V(3).Infof("GloalReserve is listening %s", listeningPort)
+func (gr *GloalReserve) isStopped() bool {
+	return atomic.LoadInt32(&gr.stopped) == 1
+}
 
-	go func() {
-		log.Println(http.ListenAndServe(":"+listeningPort, router))
-	}()
+// Collect fills the cache from the listers if it is empty
+func (gr *GloalReserve) Collect() error {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
 
-	return gr, nil
+	if gr.NextResourceID > 0 {
+		return nil
+	}
+	return gr.CollectFromLister()
+}
+
+// Configure applies the accounting settings in conf, it must be called before CollectFromLister
+func (gr *GloalReserve) Configure(conf *GRConf) error {
+	podRequests, err := GetPodRequestExtractor(conf.PodRequestExtractor)
+	if err != nil {
+		return err
+	}
+	nodeCapacities, err := GetNodeCapacityExtractor(conf.NodeCapacityExtractor)
+	if err != nil {
+		return err
+	}
+
+	if err := ValidatePlacementStrategy(conf.PlacementStrategy); err != nil {
+		return err
+	}
+
+	nodePools, err := NewNodePools(conf.NodePools)
+	if err != nil {
+		return err
+	}
+	emergencyPriority := conf.EmergencyPriority
+	defaults, err := NewNodePool(&NodePoolConf{
+		Overcommit:        conf.Overcommit,
+		Headroom:          conf.Headroom,
+		Emergency:         conf.Emergency,
+		EmergencyPriority: &emergencyPriority,
+	})
+	if err != nil {
+		return err
+	}
+
+	gr.PodRequests = podRequests
+	gr.NodeCapacities = nodeCapacities
+	gr.Defaults = defaults
+	gr.NodePools = nodePools
+	gr.PlacementStrategy = conf.PlacementStrategy
+	gr.ReservationTTL = time.Duration(conf.ReservationTTLSeconds) * time.Second
+	gr.PlaceholderTTL = time.Duration(conf.PlaceholderTTLSeconds) * time.Second
+	gr.ResourceTypeBuffer = conf.ResourceTypeBuffer
+	gr.Quotas = conf.Quotas
+	gr.ConsistencyCheck = conf.ConsistencyCheck
+	gr.ReconcileInterval = 0
+	if conf.ReconcileIntervalSeconds > 0 {
+		gr.ReconcileInterval = time.Duration(conf.ReconcileIntervalSeconds) * time.Second
+	}
+	gr.Extractors = nil
+	if len(conf.SharedResources) > 0 {
+		gr.Extractors = append(gr.Extractors, NewAnnotationExtractor(conf.SharedResources))
+	}
+
+	return nil
 }
 
 // CollectFromLister collects all nodes and pods in the cluster, and saves in the cache
@@ -123,7 +281,7 @@ func (gr *GloalReserve) CollectFromLister() error {
 	*/
 	for _, nodeInfo := range nodes {
 		node := nodeInfo.Node()
-		for resName := range node.Status.Allocatable {
+		for resName := range gr.nodeCapacity(node) {
 			if _, ok := gr.ResTypeToID[resName]; !ok {
 				gr.ResTypeToID[resName] = gr.NextResourceID
 				gr.NextResourceID++
@@ -131,12 +289,16 @@ func (gr *GloalReserve) CollectFromLister() error {
 		}
 	}
 
-	gr.ResTypeMaxKind = gr.NextResourceID + ResourceTypeBuffer
+	resourceTypeBuffer := ResourceTypeBuffer
+	if gr.ResourceTypeBuffer > 0 {
+		resourceTypeBuffer = gr.ResourceTypeBuffer
+	}
+	gr.ResTypeMaxKind = gr.NextResourceID + resourceTypeBuffer
 
 	// collect all nodes
 	for _, nodeInfo := range nodes {
 		node := nodeInfo.Node()
-		gr.NodeCache[node.Name] = NewNodeResInfo(node, gr.ResTypeToID, gr.ResTypeMaxKind)
+		gr.NodeCache[node.Name] = gr.newNodeResInfo(node)
 	}
 	// list all pods
 	pods, err := gr.PodLister.List(labels.Everything())
@@ -150,13 +312,13 @@ func (gr *GloalReserve) CollectFromLister() error {
 		hostname := pod.Spec.NodeName
 		if len(hostname) > 0 {
 			if podsOnHost, ok := gr.NodeCache[hostname]; ok {
-				podsOnHost.AddPodToCache(pod, gr.ResTypeToID)
+				podsOnHost.AddPodReqToCache(pod, gr.podRequest(pod))
 				gr.PodToNode[pod.UID] = hostname
 			} else {
-				klog.Warningf("Pod %s is binded on %s, but the node does not exist in Node list", pod.Name, hostname)
+				klog.Warningf("Pod %s is binded on %s, but the node does not exist in Node list", PodKey(pod), hostname)
 			}
 		} else {
-			klog.V(3).Infof("Pod %s is not binded, ignore it.", pod.Name)
+			klog.V(3).Infof("Pod %s is not binded, ignore it.", PodKey(pod))
 		}
 	}
 
@@ -180,112 +342,412 @@ func (gr *GloalReserve) Dump() {
 	}
 }
 
-// Reserve pod resource from the specified nodename
-func (gr *GloalReserve) Reserve(pod *v1.Pod, nodeName string) string {
+// podRequest translates the pod requests including the extra resources into a resVector
+func (gr *GloalReserve) podRequest(pod *v1.Pod) resVector {
+	podReq := make([]int64, gr.ResTypeMaxKind)
+	ResourceListToVector(ExtractPodRequests(pod, gr.PodRequests, gr.Extractors), gr.ResTypeToID, podReq)
+
+	return podReq
+}
+
+// nodeCapacity returns the capacity of the node including the extra resources
+func (gr *GloalReserve) nodeCapacity(node *v1.Node) v1.ResourceList {
+	baseCapa := node.Status.Allocatable
+	if gr.NodeCapacities != nil {
+		baseCapa = gr.NodeCapacities.NodeCapacity(node)
+	}
+	if len(gr.Extractors) == 0 {
+		return baseCapa
+	}
+
+	capa := baseCapa.DeepCopy()
+	if capa == nil {
+		capa = v1.ResourceList{}
+	}
+	for _, extractor := range gr.Extractors {
+		for resName, resValue := range extractor.NodeResources(node) {
+			capa[resName] = resValue
+		}
+	}
+
+	return capa
+}
+
+// newNodeResInfo creates a NodeResInfo with the capacity returned by nodeCapacity, the overcommit
+// ratios and the headroom of the cluster and the node pool are applied
+func (gr *GloalReserve) newNodeResInfo(node *v1.Node) *NodeResInfo {
+	nr := newNodeResInfoWithCapa(node, gr.nodeCapacity(node), gr.ResTypeToID, gr.ResTypeMaxKind)
+	pool := MatchNodePool(gr.NodePools, node)
+	if pool != nil {
+		nr.Pool = pool.Name
+	}
+	nr.SetOvercommit(gr.Defaults, pool, gr.ResTypeToID)
+	nr.SetHeadroom(gr.Defaults, pool, gr.ResTypeToID)
+	nr.SetZones(GetNodeZones(node), gr.ResTypeToID)
+
+	return nr
+}
+
+// GetNodeStatus returns the raw, effective and available resources of a node
+func (gr *GloalReserve) GetNodeStatus(nodeName string) (*NodeResourceStatus, error) {
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	nodeInfo, ok := gr.NodeCache[nodeName]
+	if !ok {
+		return nil, newReserveError(NodeNotFoundReason, "node %s does not exist", nodeName)
+	}
+
+	return gr.nodeStatus(nodeInfo), nil
+}
+
+// ListNodeStatus returns the resources of all nodes
+func (gr *GloalReserve) ListNodeStatus() []*NodeResourceStatus {
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	result := make([]*NodeResourceStatus, 0, len(gr.NodeCache))
+	for _, nodeInfo := range gr.NodeCache {
+		result = append(result, gr.nodeStatus(nodeInfo))
+	}
+
+	return result
+}
+
+// ListNodeStatusWithContext returns the status of all nodes
+func (gr *GloalReserve) ListNodeStatusWithContext(ctx context.Context) ([]*NodeResourceStatus, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	return gr.ListNodeStatus(), nil
+}
+
+// CheckConsistency recomputes the requested and reserved totals of all nodes from their pods, the
+// inconsistent totals are repaired and returned as errors
+func (gr *GloalReserve) CheckConsistency() []error {
 	gr.mu.Lock()
 	defer gr.mu.Unlock()
 
-	retStr := ""
+	var errs []error
+	for _, nodeInfo := range gr.NodeCache {
+		if err := nodeInfo.CheckUsage(); err != nil {
+			klog.Errorf("%s, repaired", err.Error())
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+func (gr *GloalReserve) nodeStatus(nodeInfo *NodeResInfo) *NodeResourceStatus {
+	nodeInfo.mu.Lock()
+	defer nodeInfo.mu.Unlock()
+
+	return &NodeResourceStatus{
+		Name:              nodeInfo.Name,
+		Pool:              nodeInfo.Pool,
+		Capacity:          VectorToResourceList(nodeInfo.RawCapa, gr.ResTypeToID),
+		EffectiveCapacity: VectorToResourceList(nodeInfo.Capa, gr.ResTypeToID),
+		Available:         VectorToResourceList(nodeInfo.GetAvailable(), gr.ResTypeToID),
+		Requested:         VectorToResourceList(nodeInfo.Requested, gr.ResTypeToID),
+		Reserved:          VectorToResourceList(nodeInfo.Reserved, gr.ResTypeToID),
+		Headroom:          VectorToResourceList(nodeInfo.Headroom, gr.ResTypeToID),
+		Emergency:         VectorToResourceList(nodeInfo.Emergency, gr.ResTypeToID),
+	}
+}
+
+// Reserve pod resource from the specified nodename
+func (gr *GloalReserve) Reserve(pod *v1.Pod, nodeName string) string {
+	if err := gr.ReserveWithContext(context.Background(), pod, nodeName); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// ReserveWithContext reserves the pod on the node, it returns a ReserveError if it fails
+func (gr *GloalReserve) ReserveWithContext(ctx context.Context, pod *v1.Pod, nodeName string) error {
+	_, err := gr.ReservePodsWithContext(ctx, []*v1.Pod{pod}, []string{nodeName})
+	return err
+}
+
+// FeasibleNodes returns the names of the nodes which can hold the pod now, ordered by name. It only
+// reads the cache with GloalReserve.mu read locked, so it runs in parallel with the reservations on
+// other nodes. The nodes are locked one by one, or all together if the pod needs the quota of its
+// scheduler or a booked pool shared by many nodes. The expired reservations and placeholders are
+// still counted until the next reservation removes them.
+func (gr *GloalReserve) FeasibleNodes(pod *v1.Pod) ([]string, error) {
 	// nothing in the cache, collect all pods and nodes
+	gr.mu.RLock()
 	if gr.NextResourceID == 0 {
-		gr.CollectFromLister()
+		gr.mu.RUnlock()
+		if err := gr.Collect(); err != nil {
+			return nil, err
+		}
+		gr.mu.RLock()
+	}
+	defer gr.mu.RUnlock()
+
+	now := time.Now()
+	podReq := gr.podRequest(pod)
+	rs := gr.reserveStateAt(now)
+	all := make([]*NodeResInfo, 0, len(gr.NodeCache))
+	names := make([]string, 0, len(gr.NodeCache))
+	for nodeName, nodeInfo := range gr.NodeCache {
+		all = append(all, nodeInfo)
+		names = append(names, nodeName)
 	}
 
-	if nodeInfo, ok := gr.NodeCache[nodeName]; ok {
-		checkResult := nodeInfo.CheckPod(pod, gr.ResTypeToID)
-		if checkResult {
-			nodeInfo.AddPodToCache(pod, gr.ResTypeToID)
-			gr.PodToNode[pod.UID] = nodeName
-		} else {
-			retStr = "Resource is not enough."
+	nodes := make([]string, 0, len(gr.NodeCache))
+	if gr.nodeLocal([]*v1.Pod{pod}, all, now) {
+		for _, nodeInfo := range all {
+			nodeInfo.mu.Lock()
+			_, fit := rs.fit(pod, podReq, nodeInfo, false)
+			nodeInfo.mu.Unlock()
+			if fit {
+				nodes = append(nodes, nodeInfo.Name)
+			}
 		}
 	} else {
-		// the host does not exist
-		retStr = "NodeName does not exist"
+		locked, _ := gr.lockNodes(names)
+		for _, nodeInfo := range locked {
+			if _, fit := rs.fit(pod, podReq, nodeInfo, false); fit {
+				nodes = append(nodes, nodeInfo.Name)
+			}
+		}
+		for i := len(locked) - 1; i >= 0; i-- {
+			locked[i].mu.Unlock()
+		}
 	}
 
-	return retStr
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// addPod saves a checked pod into the cache, the pod is removed from the node it is already cached on
+func (gr *GloalReserve) addPod(nodeInfo *NodeResInfo, pod *v1.Pod, podReq resVector, zone string) {
+	if oldNode, ok := gr.podNode(pod.UID); ok && oldNode != nodeInfo.Name {
+		if oldNodeInfo, ok := gr.NodeCache[oldNode]; ok {
+			klog.V(3).Infof("Pod %s is moved from node %s to node %s", PodKey(pod), oldNode, nodeInfo.Name)
+			oldNodeInfo.removePod(pod.UID)
+		}
+	}
+	nodeInfo.AddPodReqToCache(pod, podReq)
+	podInfo := nodeInfo.Pods[pod.UID]
+	podInfo.Zone = zone
+	nodeInfo.setPodState(podInfo, ReservedState)
+	podInfo.ReservedAt = time.Now()
+	gr.setPodNode(pod.UID, nodeInfo.Name)
 }
 
 // Unreserve pod resources from the specified nodename
 func (gr *GloalReserve) Unreserve(pod *v1.Pod, nodeName string) {
-	gr.mu.Lock()
-	defer gr.mu.Unlock()
+	if err := gr.UnreserveWithContext(context.Background(), pod, nodeName); err != nil {
+		klog.V(3).Infof("Unreserve pod %s failed with: %s", PodKey(pod), err.Error())
+	}
+}
 
-	delete(gr.PodToNode, pod.UID)
-	if nodeInfo, ok := gr.NodeCache[nodeName]; ok {
-		nodeInfo.DeletePod(pod)
-	} else {
-		// the host does not exist
-		klog.V(3).Infof("NodeName does not exist")
+// UnreserveWithContext releases the pod on the node, releasing a pod not reserved is not an error
+func (gr *GloalReserve) UnreserveWithContext(ctx context.Context, pod *v1.Pod, nodeName string) error {
+	if err := contextError(ctx); err != nil {
+		return err
+	}
+
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	nodes, ok := gr.lockNodes([]string{nodeName})
+	if !ok {
+		gr.deletePodNodeOn(pod.UID, nodeName)
+		return newReserveError(NodeNotFoundReason, "node %s does not exist", nodeName)
+	}
+	defer gr.unlockNodes(nodes)
+
+	nodes[0].DeletePod(pod)
+	gr.deletePodNodeOn(pod.UID, nodeName)
+	return nil
+}
+
+// UnreserveUID releases the pod with the uid on the node it is cached, the node is found by
+// PodToNode so the pod object is not needed. The result has an empty Node if the pod is not cached,
+// which is not an error.
+func (gr *GloalReserve) UnreserveUID(ctx context.Context, uid types.UID) (PodResult, error) {
+	result := PodResult{UID: uid}
+	if err := contextError(ctx); err != nil {
+		result.setError(err)
+		return result, err
+	}
+
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	for {
+		nodeName, ok := gr.podNode(uid)
+		if !ok {
+			return result, nil
+		}
+		nodes, ok := gr.lockNodes([]string{nodeName})
+		if !ok {
+			gr.deletePodNodeOn(uid, nodeName)
+			return result, nil
+		}
+
+		// the pod may be moved before the node is locked
+		if current, _ := gr.podNode(uid); current == nodeName {
+			result, _ = gr.releasePod(nodes[0], uid)
+			gr.unlockNodes(nodes)
+			return result, nil
+		}
+		gr.unlockNodes(nodes)
 	}
 }
 
 // ReservePods works for pods
 func (gr *GloalReserve) ReservePods(pods []*v1.Pod, nodeNames []string) *PodReserveResult {
-	// group pods by hostname
-	hostToAvailabel := make(map[string][]int64)
+	results, err := gr.ReservePodsWithContext(context.Background(), pods, nodeNames)
+	return newPodReserveResult(results, err)
+}
 
-	failed := make([]string, 0, len(pods))
-	var errorReason string
+// ReservePodsWithContext reserves all pods on their nodes or none of them, it returns the result of
+// every pod and the error of the first failed pod
+func (gr *GloalReserve) ReservePodsWithContext(ctx context.Context, pods []*v1.Pod, nodeNames []string) ([]PodResult, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	if len(pods) != len(nodeNames) {
+		return nil, newReserveError(InvalidRequestReason, "the numbers of pods and nodes are different")
+	}
+
+	// most batches only touch their own nodes and do not block the batches on other nodes
+	if results, done, err := gr.reservePodsOnNodes(ctx, pods, nodeNames); done {
+		return results, err
+	}
 
 	gr.mu.Lock()
 	defer gr.mu.Unlock()
 
+	// the context may be done while waiting for the lock
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
 	// nothing in the cache, collect all pods and nodes
 	if gr.NextResourceID == 0 {
 		gr.CollectFromLister()
 	}
 
-	for i, p := range pods {
-		nodeName := nodeNames[i]
-		if nodeInfo, ok := gr.NodeCache[nodeName]; !ok {
-			failed = append(failed, p.Name)
-			errorReason = "Node does not exist"
-		} else {
-			if _, ok1 := hostToAvailabel[nodeName]; !ok1 {
-				hostToAvailabel[nodeName] = nodeInfo.GetAvailable()
+	results, err := gr.reservePods(gr.newReserveState(time.Now()), pods, nodeNames)
+	if gr.ConsistencyCheck {
+		nodes := make([]*NodeResInfo, 0, len(nodeNames))
+		for _, nodeName := range nodeNames {
+			if nodeInfo, ok := gr.NodeCache[nodeName]; ok {
+				nodes = append(nodes, nodeInfo)
 			}
 		}
+		gr.checkUsage(nodes)
+	}
+	return results, err
+}
+
+// reservePodsOnNodes reserves the pods with only their nodes locked, done is false if nothing is
+// done because the pods need the whole cache locked
+func (gr *GloalReserve) reservePodsOnNodes(ctx context.Context, pods []*v1.Pod, nodeNames []string) (results []PodResult, done bool, err error) {
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	if gr.NextResourceID == 0 {
+		return nil, false, nil
+	}
+	nodes, ok := gr.lockPodNodes(pods, nodeNames)
+	if !ok {
+		return nil, false, nil
+	}
+	defer gr.unlockNodes(nodes)
+
+	now := time.Now()
+	if !gr.nodeLocal(pods, nodes, now) {
+		return nil, false, nil
+	}
+
+	// the context may be done while waiting for the locks
+	if err := contextError(ctx); err != nil {
+		return nil, true, err
+	}
+
+	results, err = gr.reservePods(gr.newNodeReserveState(now, nodes), pods, nodeNames)
+	return results, true, err
+}
+
+// reservePods checks and saves the pods with rs, all nodes of the pods must be locked
+func (gr *GloalReserve) reservePods(rs *reserveState, pods []*v1.Pod, nodeNames []string) ([]PodResult, error) {
+	results := make([]PodResult, len(pods))
+	for i, p := range pods {
+		results[i] = PodResult{Pod: PodKey(p), UID: p.UID, Node: nodeNames[i]}
 	}
 
-	if len(errorReason) > 0 {
-		return &PodReserveResult{
-			FailedPods: failed,
-			Error:      errorReason,
+	failed := false
+	for i := range pods {
+		if _, ok := gr.NodeCache[nodeNames[i]]; !ok {
+			results[i].setError(newReserveError(NodeNotFoundReason, "node %s does not exist", nodeNames[i]))
+			failed = true
 		}
 	}
+	if failed {
+		return abortResults(results)
+	}
 
 	// check pods one by one
+	podReqs := make([]resVector, len(pods))
 	for i, p := range pods {
-		nodeName := nodeNames[i]
-		podReq := make([]int64, gr.ResTypeMaxKind)
-		GetPodReq(p, gr.ResTypeToID, podReq)
-		if VectorCompare(hostToAvailabel[nodeName], podReq) {
-			VectorMinus(hostToAvailabel[nodeName], podReq)
+		podReqs[i] = gr.podRequest(p)
+		zone, fit := rs.fit(p, podReqs[i], gr.NodeCache[nodeNames[i]], true)
+		if fit {
+			results[i].Zone = zone
 		} else {
-			failed = append(failed, p.Name)
-			errorReason = "Node does not have enough resource"
+			results[i].setError(newReserveError(InsufficientResourcesReason,
+				"node %s does not have enough resource for pod %s", nodeNames[i], PodKey(p)))
+			failed = true
 		}
 	}
-
-	if len(errorReason) > 0 {
-		return &PodReserveResult{
-			FailedPods: failed,
-			Error:      errorReason,
-		}
+	if failed {
+		return abortResults(results)
 	}
 
+	rs.commit()
 	for i, p := range pods {
-		nodeName := nodeNames[i]
-		gr.NodeCache[nodeName].AddPodToCache(p, gr.ResTypeToID)
-		gr.PodToNode[p.UID] = nodeName
+		gr.addPod(gr.NodeCache[nodeNames[i]], p, podReqs[i], results[i].Zone)
 	}
 
-	// add pods by hostname
-	return &PodReserveResult{
-		FailedPods: failed,
-		Error:      "",
+	return results, nil
+}
+
+// PodZone returns the NUMA zone reserved for the pod, empty if the pod is not zone aligned
+func (gr *GloalReserve) PodZone(uid types.UID) string {
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	nodeName, _ := gr.podNode(uid)
+	if nodes, ok := gr.lockNodes([]string{nodeName}); ok {
+		defer gr.unlockNodes(nodes)
+		if podInfo, ok := nodes[0].Pods[uid]; ok {
+			return podInfo.Zone
+		}
+	}
+
+	return ""
+}
+
+// SetNodeZones replaces the NUMA zones of a node, it is used to feed the zones from
+// NodeResourceTopology objects instead of NUMAZonesAnnotation, the zones are kept by the node updates
+// until the node gets the annotation
+func (gr *GloalReserve) SetNodeZones(nodeName string, zones map[string]v1.ResourceList) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	if nodeInfo, ok := gr.NodeCache[nodeName]; ok {
+		nodeInfo.SetZones(zones, gr.ResTypeToID)
+		nodeInfo.fedZones = zones
+	} else {
+		klog.V(3).Infof("Node %s does not exist, ignore its zones.", nodeName)
 	}
 }
 
@@ -17,9 +17,14 @@
 package reserve
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
 	"testing"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 func TestHttpReserve(t *testing.T) {
@@ -37,7 +42,7 @@ func TestHttpReserve(t *testing.T) {
 
 	t.Run("HttpReserve reserve on non-exist node", func(t *testing.T) {
 		ret := gr.ReservePods(pods0, hosts0)
-		if len(ret.FailedPods) != 1 || ret.FailedPods[0] != "pod3" || len(ret.Error) <= 0 {
+		if len(ret.FailedPods) != 1 || ret.FailedPods[0] != "NS1/pod3" || len(ret.Error) <= 0 {
 			t.Errorf("reserve on non-exist node failed")
 		}
 	})
@@ -47,7 +52,7 @@ func TestHttpReserve(t *testing.T) {
 
 	t.Run("HttpReserve reserve too much", func(t *testing.T) {
 		ret := gr.ReservePods(pods1, hosts1)
-		if len(ret.FailedPods) != 1 || ret.FailedPods[0] != "pod2" || len(ret.Error) <= 0 {
+		if len(ret.FailedPods) != 1 || ret.FailedPods[0] != "NS1/pod2" || len(ret.Error) <= 0 {
 			t.Errorf("reserve too much failed")
 		}
 	})
@@ -129,4 +134,48 @@ func TestUnreserve(t *testing.T) {
 			t.Errorf("Unreserve success failed")
 		}
 	})
+
+	t.Run("Unreserve by UID route", func(t *testing.T) {
+		ser, err := InitHTTPServer(gr)
+		if err != nil {
+			t.Fatalf("starting the http server failed with %s", err.Error())
+		}
+		defer ser.Close()
+
+		body, _ := json.Marshal(&PodsReserveRequest{SchedulerName: "s", UIDs: []types.UID{pod1.UID, "NS1-gone"}})
+		resp, err := http.Post(ser.URL()+UnreserveHTTPPathPrefix, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("by UID route failed with %s", err.Error())
+		}
+		defer resp.Body.Close()
+
+		var result PodReserveResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || len(result.Error) > 0 || len(result.Results) != 2 ||
+			result.Results[0].Pod != "NS1/pod1" || result.Results[0].Node != "node0" || len(result.Results[1].Node) > 0 {
+			t.Errorf("by UID route failed: %v %v", err, result)
+		}
+		if len(gr.PodToNode) != 0 || len(gr.NodeCache["node0"].Pods) != 0 {
+			t.Errorf("by UID route failed, the pod is still cached")
+		}
+	})
+
+	t.Run("Unreserve by UID", func(t *testing.T) {
+		pod2 := GetPod("pod1", "500m", "1000", "", v1.PodPending)
+		pod2.Namespace = "NS2"
+		pod2.UID = "NS2-pod1"
+		if ret := gr.Reserve(pod2, "node0"); len(ret) > 0 {
+			t.Fatalf("reserve failed: %s", ret)
+		}
+
+		result, err := gr.UnreserveUID(context.TODO(), pod2.UID)
+		if err != nil || result.Pod != "NS2/pod1" || result.Node != "node0" {
+			t.Errorf("Unreserve by UID failed: %v %v", result, err)
+		}
+		if _, ok := gr.PodToNode[pod2.UID]; ok || len(gr.NodeCache["node0"].Pods) != 0 {
+			t.Errorf("Unreserve by UID failed, the pod is still cached")
+		}
+		if result, err := gr.UnreserveUID(context.TODO(), pod2.UID); err != nil || len(result.Node) > 0 {
+			t.Errorf("Unreserve by UID not cached failed: %v %v", result, err)
+		}
+	})
 }
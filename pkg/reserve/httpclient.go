@@ -18,104 +18,360 @@ package reserve
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
-	"sync"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
 	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/klog"
 )
 
 // GloalReserveHTTPClient connects with http server created by GloalReserve
 type GloalReserveHTTPClient struct {
-	mu         sync.RWMutex
-	client     *http.Client
-	reserveURL string
+	client      *http.Client // safe for concurrent use
+	reserveURLs []string     // tried in order until one of them can be connected
+	//sent with every request, selects the pods of this client in quotas and releases
+	schedulerName string
 }
 
 var _ GlobalReserverInterface = &GloalReserveHTTPClient{}
 
-// NewHTTPClient creats an http client
+// NewHTTPClient creats an http client, timeout is in seconds
 func NewHTTPClient(url string, timeout int) (GlobalReserverInterface, error) {
-	transport := utilnet.SetTransportDefaults(&http.Transport{})
+	return newHTTPClient([]string{url}, timeout, nil, ""), nil
+}
+
+// NewHTTPClientFromConf creats an http client connecting the remote endpoints in conf
+func NewHTTPClientFromConf(conf *GRConf) (GlobalReserverInterface, error) {
+	urls := conf.remoteURLs()
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no remote URL is specified")
+	}
+
+	tlsConfig, err := conf.clientTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return newHTTPClient(urls, conf.RemoteTimeoutSeconds, tlsConfig, conf.SchedulerName), nil
+}
+
+func newHTTPClient(urls []string, timeout int, tlsConfig *tls.Config, schedulerName string) *GloalReserveHTTPClient {
+	if timeout <= 0 {
+		timeout = DefaultRemoteTimeoutSeconds
+	}
+	if len(schedulerName) == 0 {
+		schedulerName = ReserveSchedulerName
+	}
+
+	transport := utilnet.SetTransportDefaults(&http.Transport{TLSClientConfig: tlsConfig})
 	c := &http.Client{
 		Transport: transport,
-		Timeout:   5 * time.Second,
+		Timeout:   time.Duration(timeout) * time.Second,
+	}
+
+	reserveURLs := make([]string, 0, len(urls))
+	for _, url := range urls {
+		reserveURLs = append(reserveURLs, strings.TrimRight(url, "/"))
 	}
 
 	return &GloalReserveHTTPClient{
-		client:     c,
-		reserveURL: strings.TrimRight(url, "/"),
-	}, nil
+		client:        c,
+		reserveURLs:   reserveURLs,
+		schedulerName: schedulerName,
+	}
 }
 
 // Reserve uses http.Client to reserver from remote GloalReserve
 func (grhc *GloalReserveHTTPClient) Reserve(pod *v1.Pod, nodeName string) string {
-	grhc.mu.Lock()
-	defer grhc.mu.Unlock()
-
 	podsArr := []*v1.Pod{pod}
 	nodesArr := []string{nodeName}
 
 	reqData := &PodsReserveRequest{
 		Pods:          podsArr,
 		Nodes:         nodesArr,
-		SchedulerName: ReserveSchedulerName,
+		SchedulerName: grhc.schedulerName,
 	}
 
 	return grhc.send(reqData, ReserveHTTPPathPrefix)
 }
 
+// ReservePods uses http.Client to reserve all pods or none of them from remote GloalReserve
+func (grhc *GloalReserveHTTPClient) ReservePods(pods []*v1.Pod, nodeNames []string) *PodReserveResult {
+	reqData := &PodsReserveRequest{
+		Pods:          pods,
+		Nodes:         nodeNames,
+		SchedulerName: grhc.schedulerName,
+	}
+
+	var result PodReserveResult
+	if err := grhc.post(reqData, ReserveHTTPPathPrefix, &result); err != nil {
+		return &PodReserveResult{Error: err.Error()}
+	}
+
+	return &result
+}
+
 // Unreserve uses http.Client to unreserver from remote GloalReserve
 func (grhc *GloalReserveHTTPClient) Unreserve(pod *v1.Pod, nodeName string) {
-	grhc.mu.Lock()
-	defer grhc.mu.Unlock()
-
 	podsArr := []*v1.Pod{pod}
 	nodesArr := []string{nodeName}
 
 	reqData := &PodsReserveRequest{
 		Pods:          podsArr,
 		Nodes:         nodesArr,
-		SchedulerName: ReserveSchedulerName,
+		SchedulerName: grhc.schedulerName,
 	}
 
 	grhc.send(reqData, UnreserveHTTPPathPrefix)
 }
 
-func (grhc *GloalReserveHTTPClient) send(data *PodsReserveRequest, actionPath string) string {
-	tmp, err := json.Marshal(data)
-	if err != nil {
-		return err.Error()
+// UnreservePods uses http.Client to unreserve all pods from remote GloalReserve in one request
+func (grhc *GloalReserveHTTPClient) UnreservePods(pods []*v1.Pod, nodeNames []string) {
+	reqData := &PodsReserveRequest{
+		Pods:          pods,
+		Nodes:         nodeNames,
+		SchedulerName: grhc.schedulerName,
 	}
 
-	reqURL := grhc.reserveURL + actionPath
+	grhc.send(reqData, UnreserveHTTPPathPrefix)
+}
 
-	req, err := http.NewRequest("POST", reqURL, bytes.NewReader(tmp))
-	if err != nil {
-		return err.Error()
+// FeasibleNodes uses http.Client to query the nodes which can hold the pod from remote GloalReserve
+func (grhc *GloalReserveHTTPClient) FeasibleNodes(pod *v1.Pod) ([]string, error) {
+	reqData := &PodsReserveRequest{
+		Pods:          []*v1.Pod{pod},
+		SchedulerName: grhc.schedulerName,
+	}
+
+	var result FeasibleResult
+	if err := grhc.post(reqData, FeasibleHTTPPathPrefix, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Error) > 0 {
+		return nil, fmt.Errorf("%s", result.Error)
+	}
+
+	return result.Nodes, nil
+}
+
+// VerifyReservation uses http.Client to verify the pod is still reserved in remote GloalReserve
+func (grhc *GloalReserveHTTPClient) VerifyReservation(pod *v1.Pod, nodeName string) error {
+	return grhc.podAction(pod, nodeName, VerifyHTTPPathPrefix)
+}
+
+// ConfirmBinding uses http.Client to mark the pod as bound in remote GloalReserve
+func (grhc *GloalReserveHTTPClient) ConfirmBinding(pod *v1.Pod, nodeName string) error {
+	return grhc.podAction(pod, nodeName, ConfirmHTTPPathPrefix)
+}
+
+func (grhc *GloalReserveHTTPClient) podAction(pod *v1.Pod, nodeName string, actionPath string) error {
+	reqData := &PodsReserveRequest{
+		Pods:          []*v1.Pod{pod},
+		Nodes:         []string{nodeName},
+		SchedulerName: grhc.schedulerName,
+	}
+
+	var result PodReserveResult
+	if err := grhc.post(reqData, actionPath, &result); err != nil {
+		return err
 	}
+	return errorFromResult(result.Reason, result.Error)
+}
+
+// ReserveWithContext uses http.Client to reserve the pod from remote GloalReserve
+func (grhc *GloalReserveHTTPClient) ReserveWithContext(ctx context.Context, pod *v1.Pod, nodeName string) error {
+	_, err := grhc.ReservePodsWithContext(ctx, []*v1.Pod{pod}, []string{nodeName})
+	return err
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// ReservePodsWithContext uses http.Client to reserve all pods or none of them from remote GloalReserve
+func (grhc *GloalReserveHTTPClient) ReservePodsWithContext(ctx context.Context, pods []*v1.Pod, nodeNames []string) ([]PodResult, error) {
+	reqData := &PodsReserveRequest{
+		Pods:          pods,
+		Nodes:         nodeNames,
+		SchedulerName: grhc.schedulerName,
+	}
+
+	var result PodReserveResult
+	if err := grhc.postWithContext(ctx, reqData, ReserveHTTPPathPrefix, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Results, errorFromResult(result.Reason, result.Error)
+}
 
-	resp, err := grhc.client.Do(req)
+// UnreserveWithContext uses http.Client to unreserve the pod from remote GloalReserve
+func (grhc *GloalReserveHTTPClient) UnreserveWithContext(ctx context.Context, pod *v1.Pod, nodeName string) error {
+	reqData := &PodsReserveRequest{
+		Pods:          []*v1.Pod{pod},
+		Nodes:         []string{nodeName},
+		SchedulerName: grhc.schedulerName,
+	}
+
+	var result PodReserveResult
+	if err := grhc.postWithContext(ctx, reqData, UnreserveHTTPPathPrefix, &result); err != nil {
+		return err
+	}
+
+	return errorFromResult(result.Reason, result.Error)
+}
+
+// ReleaseWithContext uses http.Client to release the pods selected by the request from remote GloalReserve
+func (grhc *GloalReserveHTTPClient) ReleaseWithContext(ctx context.Context, request *ReleaseRequest) ([]PodResult, error) {
+	var result ReleaseResult
+	if err := grhc.postWithContext(ctx, request, ReleaseHTTPPathPrefix, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Released, errorFromResult(result.Reason, result.Error)
+}
+
+// ListNodeStatusWithContext uses http.Client to query all nodes from remote GloalReserve
+func (grhc *GloalReserveHTTPClient) ListNodeStatusWithContext(ctx context.Context) ([]*NodeResourceStatus, error) {
+	var status []*NodeResourceStatus
+	if err := grhc.getWithContext(ctx, NodesHTTPPathPrefix, &status); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// AvailableUntilWithContext uses http.Client to query the resources free on the node until the time
+// until from remote GloalReserve
+func (grhc *GloalReserveHTTPClient) AvailableUntilWithContext(ctx context.Context, nodeName string, until time.Time) (*NodeAvailability, error) {
+	var result NodeAvailability
+	actionPath := NodesHTTPPathPrefix + "/" + url.PathEscape(nodeName) + "/available?until=" + url.QueryEscape(until.Format(time.RFC3339))
+	if err := grhc.getWithContext(ctx, actionPath, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// GetNodeStatus uses http.Client to query one node from remote GloalReserve
+func (grhc *GloalReserveHTTPClient) GetNodeStatus(nodeName string) (*NodeResourceStatus, error) {
+	var status NodeResourceStatus
+	if err := grhc.get(NodesHTTPPathPrefix+"/"+url.PathEscape(nodeName), &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// ListNodeStatus uses http.Client to query all nodes from remote GloalReserve, nil if it fails
+func (grhc *GloalReserveHTTPClient) ListNodeStatus() []*NodeResourceStatus {
+	var status []*NodeResourceStatus
+	if err := grhc.get(NodesHTTPPathPrefix, &status); err != nil {
+		klog.Errorf("Listing nodes failed with: %s", err.Error())
+		return nil
+	}
+
+	return status
+}
+
+func (grhc *GloalReserveHTTPClient) get(actionPath string, result interface{}) error {
+	return grhc.getWithContext(context.Background(), actionPath, result)
+}
+
+func (grhc *GloalReserveHTTPClient) getWithContext(ctx context.Context, actionPath string, result interface{}) error {
+	resp, reqURL, err := grhc.do(ctx, func(reqURL string) (*http.Request, error) {
+		return http.NewRequest("GET", reqURL, nil)
+	}, actionPath)
 	if err != nil {
-		return err.Error()
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Sprintf("Failed %s with URL %v, code %v", actionPath, reqURL, resp.StatusCode)
+		return statusError(resp.StatusCode, "Failed %s with URL %v, code %v", actionPath, reqURL, resp.StatusCode)
 	}
 
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (grhc *GloalReserveHTTPClient) send(data *PodsReserveRequest, actionPath string) string {
 	var result PodReserveResult
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	if err != nil {
+	if err := grhc.post(data, actionPath, &result); err != nil {
 		return err.Error()
 	}
 
 	return result.Error
 }
+
+func (grhc *GloalReserveHTTPClient) post(data interface{}, actionPath string, result interface{}) error {
+	return grhc.postWithContext(context.Background(), data, actionPath, result)
+}
+
+func (grhc *GloalReserveHTTPClient) postWithContext(ctx context.Context, data interface{}, actionPath string, result interface{}) error {
+	tmp, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	resp, reqURL, err := grhc.do(ctx, func(reqURL string) (*http.Request, error) {
+		req, err := http.NewRequest("POST", reqURL, bytes.NewReader(tmp))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}, actionPath)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp.StatusCode, "Failed %s with URL %v, code %v", actionPath, reqURL, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// do sends the request to the remote endpoints in order and returns the response and the URL answering
+// it. The next endpoint is tried if the connection can not be made, or for GET requests on any error.
+// Other requests may have been applied by an endpoint which did not answer, they are not resent.
+func (grhc *GloalReserveHTTPClient) do(ctx context.Context, newRequest func(reqURL string) (*http.Request, error), actionPath string) (*http.Response, string, error) {
+	var lastErr error
+	for _, reserveURL := range grhc.reserveURLs {
+		if err := contextError(ctx); err != nil {
+			return nil, "", err
+		}
+
+		reqURL := reserveURL + actionPath
+		req, err := newRequest(reqURL)
+		if err != nil {
+			return nil, reqURL, err
+		}
+
+		resp, err := grhc.client.Do(req.WithContext(ctx))
+		if err == nil {
+			return resp, reqURL, nil
+		}
+		klog.V(3).Infof("Sending %s to %s failed with: %s", actionPath, reserveURL, err.Error())
+		lastErr = err
+		if req.Method != http.MethodGet && !dialFailed(err) {
+			break
+		}
+	}
+
+	if err := contextError(ctx); err != nil {
+		return nil, "", err
+	}
+	return nil, "", newReserveError(UnavailableReason, "%v", lastErr)
+}
+
+// dialFailed returns true if the connection can not be made, the request is not sent at all
+func dialFailed(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
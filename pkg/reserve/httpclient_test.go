@@ -17,7 +17,9 @@
 package reserve
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 )
@@ -26,11 +28,14 @@ func TestHttpClient(t *testing.T) {
 	node0 := GetNode0()
 	nodes := []*v1.Node{node0}
 	gr := InitGR(nodes, nil, false)
-	ser := InitHTTPServer(gr)
+	ser, err := InitHTTPServer(gr)
+	if err != nil {
+		t.Fatalf("starting the http server failed with %s", err.Error())
+	}
 
 	pod0 := GetPod("pod0", "1000m", "1000", "node0", v1.PodPending)
 
-	ghc, _ := NewHTTPClient("http://127.0.0.1:23456", 5)
+	ghc, _ := NewHTTPClient(ser.URL(), 5)
 
 	t.Run("HttpClient reserve success", func(t *testing.T) {
 		result := ghc.Reserve(pod0, "node0")
@@ -47,6 +52,16 @@ func TestHttpClient(t *testing.T) {
 		}
 	})
 
+	t.Run("HttpClient node status", func(t *testing.T) {
+		status, err := ghc.GetNodeStatus("node0")
+		if err != nil || status.Available.Cpu().MilliValue() != 1000 || len(ghc.ListNodeStatus()) != 1 {
+			t.Errorf("node status failed")
+		}
+		if _, err := ghc.GetNodeStatus("node9"); err == nil {
+			t.Errorf("non-exist node status failed")
+		}
+	})
+
 	t.Run("HttpClient unreserve", func(t *testing.T) {
 		ghc.Unreserve(pod0, "node0")
 		if len(gr.NodeCache["node0"].Pods) != 0 {
@@ -54,5 +69,40 @@ func TestHttpClient(t *testing.T) {
 		}
 	})
 
+	t.Run("HttpClient escaped node name", func(t *testing.T) {
+		// the query of an unescaped name would select node0
+		client := ghc.(*GloalReserveHTTPClient)
+		if _, err := client.AvailableUntilWithContext(context.Background(), "node0?", time.Now()); err == nil {
+			t.Errorf("escaped node name failed")
+		}
+		if _, err := client.GetNodeStatus("node0?"); err == nil {
+			t.Errorf("escaped node name status failed")
+		}
+	})
+
+	t.Run("HttpClient scheduler name", func(t *testing.T) {
+		remote, err := NewHTTPClientFromConf(&GRConf{RemoteURL: ser.URL(), SchedulerName: "remote-scheduler"})
+		if err != nil {
+			t.Fatalf("scheduler name failed: %s", err.Error())
+		}
+		client := remote.(*GloalReserveHTTPClient)
+		pod2 := GetPod("pod2", "500m", "1000", "node0", v1.PodPending)
+		// the api server defaults the scheduler name of a real pod
+		pod3 := GetPod("pod3", "500m", "1000", "node0", v1.PodPending)
+		pod3.Spec.SchedulerName = v1.DefaultSchedulerName
+		for _, pod := range []*v1.Pod{pod2, pod3} {
+			if result := client.Reserve(pod, "node0"); len(result) > 0 {
+				t.Fatalf("scheduler name failed: %s", result)
+			}
+			if podInfo := gr.NodeCache["node0"].Pods[pod.UID]; podInfo == nil || podInfo.Source != "remote-scheduler" {
+				t.Errorf("scheduler name failed, %s is not reserved by remote-scheduler", pod.Name)
+			}
+		}
+		released, err := client.ReleaseWithContext(context.Background(), &ReleaseRequest{SchedulerName: "remote-scheduler"})
+		if err != nil || len(released) != 2 || len(gr.NodeCache["node0"].Pods) != 0 {
+			t.Errorf("scheduler name failed, the pods are not released: %v %v", released, err)
+		}
+	})
+
 	ser.Close()
 }
@@ -0,0 +1,149 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// ReserveServer is the http server of the REST API, it is listening when StartHTTPServer returns
+type ReserveServer struct {
+	server *http.Server
+	addr   string
+	done   chan struct{} // closed when Serve returns
+}
+
+// StartHTTPServer binds the address and serves the REST API of gr in the background, it fails if the
+// address can not be bound. Port 0 picks a free port, see Addr.
+func StartHTTPServer(gr *GloalReserve, address string, tls *TLSConf) (*ReserveServer, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &ReserveServer{
+		server: &http.Server{Handler: NewRouter(gr)},
+		addr:   ln.Addr().String(),
+		done:   make(chan struct{}),
+	}
+	klog.V(3).Infof("GloalReserve is listening %s", rs.addr)
+
+	go func() {
+		defer close(rs.done)
+
+		var err error
+		if tls != nil && len(tls.CertFile) > 0 {
+			err = rs.server.ServeTLS(ln, tls.CertFile, tls.KeyFile)
+		} else {
+			err = rs.server.Serve(ln)
+		}
+		if err != http.ErrServerClosed {
+			klog.Errorf("GloalReserve http server on %s stopped with: %v", rs.addr, err)
+		}
+	}()
+
+	return rs, nil
+}
+
+// Addr returns the address the server is listening
+func (rs *ReserveServer) Addr() string {
+	return rs.addr
+}
+
+// URL returns the http URL of the server for NewHTTPClient
+func (rs *ReserveServer) URL() string {
+	return "http://" + rs.addr
+}
+
+// Shutdown stops accepting requests and waits until the in-flight requests are done or ctx is done
+func (rs *ReserveServer) Shutdown(ctx context.Context) error {
+	err := rs.server.Shutdown(ctx)
+	<-rs.done
+	return err
+}
+
+// Close stops the server at once without waiting for the in-flight requests
+func (rs *ReserveServer) Close() error {
+	err := rs.server.Close()
+	<-rs.done
+	return err
+}
+
+// localReserves are the GloalReserves created by NewLocalReserve, the scheduler framework does not
+// close plugins, so the scheduler command shuts them down by ShutdownLocalReserves
+var localReserves struct {
+	mu       sync.Mutex
+	reserves []*GloalReserve
+}
+
+// ShutdownLocalReserves shuts down all GloalReserves created by NewLocalReserve, it is called when
+// the scheduler exits
+func ShutdownLocalReserves(ctx context.Context) error {
+	localReserves.mu.Lock()
+	reserves := localReserves.reserves
+	localReserves.reserves = nil
+	localReserves.mu.Unlock()
+
+	var firstErr error
+	for _, gr := range reserves {
+		if err := gr.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ShutdownLocalReservesOnSignal shuts down the local GloalReserves when the process receives SIGTERM or
+// SIGINT, waiting up to timeout for the in-flight requests, then calls exit. The scheduler command
+// does not return on these signals, so the requests would be lost without it. The returned function
+// stops watching the signals.
+func ShutdownLocalReservesOnSignal(timeout time.Duration, exit func()) (stop func()) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, os.Interrupt)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			klog.Infof("Received %s, shutting down GloalReserve", sig)
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			if err := ShutdownLocalReserves(ctx); err != nil {
+				klog.Errorf("Shutting down GloalReserve failed with: %s", err.Error())
+			}
+			cancel()
+			exit()
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigCh)
+			close(done)
+		})
+	}
+}
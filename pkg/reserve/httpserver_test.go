@@ -0,0 +1,164 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReserveServer(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0()}, nil, true)
+	ser, err := InitHTTPServer(gr)
+	if err != nil {
+		t.Fatalf("starting the http server failed with %s", err.Error())
+	}
+
+	t.Run("ReserveServer bind failure", func(t *testing.T) {
+		if _, err := StartHTTPServer(gr, ser.Addr(), nil); err == nil {
+			t.Errorf("bind failure failed")
+		}
+	})
+
+	t.Run("ReserveServer two instances", func(t *testing.T) {
+		ser2, err := InitHTTPServer(InitGR([]*v1.Node{GetNode0()}, nil, true))
+		if err != nil {
+			t.Fatalf("starting the http server failed with %s", err.Error())
+		}
+		defer ser2.Close()
+		if ser2.Addr() == ser.Addr() {
+			t.Errorf("two instances failed")
+		}
+	})
+
+	t.Run("ReserveServer drains in-flight requests", func(t *testing.T) {
+		ghc, _ := NewHTTPClient(ser.URL(), 5)
+		reserved := make(chan string)
+		shutdown := make(chan error)
+
+		// the request waits for the lock in the handler
+		gr.mu.Lock()
+		go func() {
+			reserved <- ghc.Reserve(GetPod("pod0", "1", "100", "node0", v1.PodPending), "node0")
+		}()
+		time.Sleep(100 * time.Millisecond)
+		go func() {
+			shutdown <- ser.Shutdown(context.TODO())
+		}()
+
+		select {
+		case <-shutdown:
+			t.Errorf("shutdown returns before the request is done")
+		case <-time.After(100 * time.Millisecond):
+		}
+		gr.mu.Unlock()
+
+		if ret := <-reserved; len(ret) > 0 {
+			t.Errorf("in-flight request failed: %s", ret)
+		}
+		if err := <-shutdown; err != nil {
+			t.Errorf("shutdown failed with %s", err.Error())
+		}
+		err := ghc.ReserveWithContext(context.TODO(), GetPod("pod1", "1", "100", "node0", v1.PodPending), "node0")
+		if ReasonForError(err) != UnavailableReason {
+			t.Errorf("request after shutdown failed")
+		}
+	})
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0()}, nil, true)
+	ser, err := InitHTTPServer(gr)
+	if err != nil {
+		t.Fatalf("starting the http server failed with %s", err.Error())
+	}
+	defer ser.Close()
+	gr.server = ser
+	localReserves.mu.Lock()
+	localReserves.reserves = append(localReserves.reserves, gr)
+	localReserves.mu.Unlock()
+
+	exited := make(chan struct{})
+	stop := ShutdownLocalReservesOnSignal(5*time.Second, func() { close(exited) })
+	defer stop()
+
+	t.Run("ShutdownOnSignal drains in-flight reserve", func(t *testing.T) {
+		ghc, _ := NewHTTPClient(ser.URL(), 5)
+		reserved := make(chan string)
+
+		// the request waits for the lock in the handler while SIGTERM is received
+		gr.mu.Lock()
+		go func() {
+			reserved <- ghc.Reserve(GetPod("pod0", "1", "100", "node0", v1.PodPending), "node0")
+		}()
+		time.Sleep(100 * time.Millisecond)
+		if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+			t.Fatalf("sending SIGTERM failed with %s", err.Error())
+		}
+
+		select {
+		case <-exited:
+			t.Errorf("exit is called before the request is done")
+		case <-time.After(100 * time.Millisecond):
+		}
+		gr.mu.Unlock()
+
+		if ret := <-reserved; len(ret) > 0 {
+			t.Errorf("in-flight reserve failed: %s", ret)
+		}
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			t.Errorf("exit is not called after the shutdown")
+		}
+		if _, ok := gr.NodeCache["node0"].Pods["NS1-pod0"]; !ok {
+			t.Errorf("in-flight reserve failed, the pod is not reserved")
+		}
+	})
+}
+
+func TestGloalReserveShutdown(t *testing.T) {
+	client := fake.NewSimpleClientset(GetNode0())
+	factory := informers.NewSharedInformerFactory(client, 0)
+	conf := &GRConf{}
+	conf.SetDefaults()
+	gr, _ := NewInformerReserve(factory, conf)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+	gr.Collect()
+
+	t.Run("GloalReserveShutdown ignores events", func(t *testing.T) {
+		if err := gr.Shutdown(context.TODO()); err != nil {
+			t.Fatalf("shutdown failed with %s", err.Error())
+		}
+		client.CoreV1().Nodes().Create(GetNode1())
+		time.Sleep(100 * time.Millisecond)
+		if _, ok := gr.NodeCache["node1"]; ok {
+			t.Errorf("ignores events failed")
+		}
+	})
+}
@@ -0,0 +1,103 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	schedulerlisters "k8s.io/kubernetes/pkg/scheduler/listers"
+	schedulernodeinfo "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+)
+
+// InformerNodeInfoLister lists the nodes from an informer instead of the scheduler snapshot
+type InformerNodeInfoLister struct {
+	nodeLister corelisters.NodeLister
+}
+
+var _ schedulerlisters.NodeInfoLister = &InformerNodeInfoLister{}
+
+// NewInformerNodeInfoLister wraps the node lister of an informer
+func NewInformerNodeInfoLister(nodeLister corelisters.NodeLister) *InformerNodeInfoLister {
+	return &InformerNodeInfoLister{nodeLister: nodeLister}
+}
+
+// Get returns the node by name, the pods on the node are not filled
+func (l *InformerNodeInfoLister) Get(nodeName string) (*schedulernodeinfo.NodeInfo, error) {
+	node, err := l.nodeLister.Get(nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeInfo := schedulernodeinfo.NewNodeInfo()
+	nodeInfo.SetNode(node)
+	return nodeInfo, nil
+}
+
+// List lists all nodes, the pods on the nodes are not filled
+func (l *InformerNodeInfoLister) List() ([]*schedulernodeinfo.NodeInfo, error) {
+	nodes, err := l.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	nodeInfoList := make([]*schedulernodeinfo.NodeInfo, 0, len(nodes))
+	for _, node := range nodes {
+		nodeInfo := schedulernodeinfo.NewNodeInfo()
+		nodeInfo.SetNode(node)
+		nodeInfoList = append(nodeInfoList, nodeInfo)
+	}
+	return nodeInfoList, nil
+}
+
+// HavePodsWithAffinityList is not used by GloalReserve, it returns nothing because pods are not filled
+func (l *InformerNodeInfoLister) HavePodsWithAffinityList() ([]*schedulernodeinfo.NodeInfo, error) {
+	return nil, nil
+}
+
+// InformerPodLister lists the pods from an informer instead of the scheduler snapshot
+type InformerPodLister struct {
+	podLister corelisters.PodLister
+}
+
+var _ schedulerlisters.PodLister = &InformerPodLister{}
+
+// NewInformerPodLister wraps the pod lister of an informer
+func NewInformerPodLister(podLister corelisters.PodLister) *InformerPodLister {
+	return &InformerPodLister{podLister: podLister}
+}
+
+// List returns the pods matching the selector
+func (l *InformerPodLister) List(s labels.Selector) ([]*v1.Pod, error) {
+	return l.podLister.List(s)
+}
+
+// FilteredList returns the pods matching a pod filter and a label selector
+func (l *InformerPodLister) FilteredList(podFilter schedulerlisters.PodFilter, s labels.Selector) ([]*v1.Pod, error) {
+	pods, err := l.podLister.List(s)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]*v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if podFilter(pod) {
+			selected = append(selected, pod)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,82 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInformerReserve(t *testing.T) {
+	client := fake.NewSimpleClientset(GetNode0(), GetPod("pod0", "1", "100", "node0", v1.PodRunning))
+	factory := informers.NewSharedInformerFactory(client, 0)
+
+	conf := &GRConf{}
+	conf.SetDefaults()
+	gr, err := NewInformerReserve(factory, conf)
+	if err != nil {
+		t.Fatalf("create failed with %s", err.Error())
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+
+	t.Run("InformerReserve collect", func(t *testing.T) {
+		if err := gr.Collect(); err != nil || len(gr.NodeCache["node0"].Pods) != 1 {
+			t.Errorf("collect failed")
+		}
+	})
+
+	t.Run("InformerReserve node added", func(t *testing.T) {
+		client.CoreV1().Nodes().Create(GetNode1())
+		for i := 0; i < 100; i++ {
+			if _, err := gr.GetNodeStatus("node1"); err == nil {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Errorf("node added failed")
+	})
+
+	t.Run("InformerReserve reserve", func(t *testing.T) {
+		if ret := gr.Reserve(GetPod("pod1", "1500m", "100", "node0", v1.PodPending), "node0"); len(ret) == 0 {
+			t.Errorf("reserve over capacity failed")
+		}
+		if ret := gr.Reserve(GetPod("pod1", "1", "100", "node0", v1.PodPending), "node0"); len(ret) > 0 {
+			t.Errorf("reserve failed: %s", ret)
+		}
+	})
+
+	t.Run("InformerReserve lister", func(t *testing.T) {
+		lister := NewInformerNodeInfoLister(factory.Core().V1().Nodes().Lister())
+		if nodeInfo, err := lister.Get("node0"); err != nil || nodeInfo.Node().Name != "node0" {
+			t.Errorf("lister get failed")
+		}
+		pods, err := NewInformerPodLister(factory.Core().V1().Pods().Lister()).FilteredList(
+			func(pod *v1.Pod) bool { return pod.Name != "pod0" }, labels.Everything())
+		if err != nil || len(pods) != 0 {
+			t.Errorf("lister filtered failed")
+		}
+	})
+}
@@ -0,0 +1,57 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"sync"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	reconcileRuns = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Subsystem:      "globalreserve",
+			Name:           "reconcile_runs_total",
+			Help:           "Number of times the cache is reconciled with the listers.",
+			StabilityLevel: metrics.ALPHA,
+		})
+	reconcileCorrections = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      "globalreserve",
+			Name:           "reconcile_corrections_total",
+			Help:           "Number of cache corrections made by the reconciler by kind.",
+			StabilityLevel: metrics.ALPHA,
+		}, []string{"kind"})
+	resizeOvercommits = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Subsystem:      "globalreserve",
+			Name:           "resize_overcommits_total",
+			Help:           "Number of pod resizes which overcommit the node in the cache.",
+			StabilityLevel: metrics.ALPHA,
+		})
+
+	metricsOnce sync.Once
+)
+
+// registerMetrics registers the metrics into the legacyregistry once, they are served by MetricsHTTPPathPrefix
+func registerMetrics() {
+	metricsOnce.Do(func() {
+		legacyregistry.MustRegister(reconcileRuns, reconcileCorrections, resizeOvercommits)
+	})
+}
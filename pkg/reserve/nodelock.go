@@ -0,0 +1,188 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+)
+
+// Locking of GloalReserve:
+//
+// GloalReserve.mu write locked: everything can be changed, no node lock is needed.
+// GloalReserve.mu read locked: the nodes, resource types, pools, bookings and quotas are fixed. The
+// pods and placeholders of a node can be changed with NodeResInfo.mu locked. Several nodes are
+// always locked by lockNodes in the order of their names, so batches on different nodes run in
+// parallel and batches sharing nodes do not deadlock.
+// GloalReserve.podMu guards PodToNode when GloalReserve.mu is read locked, it is always the last
+// lock taken. A pod is only indexed on or removed from a node with the node locked, so PodToNode
+// and the pods of the nodes always match.
+
+// lockNodes locks the nodes in the order of their names, it returns the locked nodes and false if
+// any node does not exist. GloalReserve.mu must be read locked.
+func (gr *GloalReserve) lockNodes(nodeNames []string) ([]*NodeResInfo, bool) {
+	names := make([]string, 0, len(nodeNames))
+	seen := make(map[string]bool, len(nodeNames))
+	for _, name := range nodeNames {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	nodes := make([]*NodeResInfo, 0, len(names))
+	for _, name := range names {
+		nodeInfo, ok := gr.NodeCache[name]
+		if !ok {
+			return nil, false
+		}
+		nodes = append(nodes, nodeInfo)
+	}
+
+	for _, nodeInfo := range nodes {
+		nodeInfo.mu.Lock()
+	}
+	return nodes, true
+}
+
+// lockPodNodes locks the nodes of nodeNames and the nodes the pods are already cached on, so the pods
+// can be moved. It returns false if any node of nodeNames does not exist.
+func (gr *GloalReserve) lockPodNodes(pods []*v1.Pod, nodeNames []string) ([]*NodeResInfo, bool) {
+	for {
+		names := append([]string{}, nodeNames...)
+		indexed := make([]string, len(pods))
+		for i, pod := range pods {
+			indexed[i], _ = gr.podNode(pod.UID)
+			if _, ok := gr.NodeCache[indexed[i]]; ok {
+				names = append(names, indexed[i])
+			}
+		}
+
+		nodes, ok := gr.lockNodes(names)
+		if !ok {
+			return nil, false
+		}
+
+		// the pods may be moved by others before the nodes are locked
+		moved := false
+		for i, pod := range pods {
+			if current, _ := gr.podNode(pod.UID); current != indexed[i] {
+				moved = true
+			}
+		}
+		if !moved {
+			return nodes, true
+		}
+		gr.unlockNodes(nodes)
+	}
+}
+
+// unlockNodes unlocks the nodes returned by lockNodes, the totals of the nodes are checked before
+// unlocking if ConsistencyCheck is set
+func (gr *GloalReserve) unlockNodes(nodes []*NodeResInfo) {
+	gr.checkUsage(nodes)
+	for i := len(nodes) - 1; i >= 0; i-- {
+		nodes[i].mu.Unlock()
+	}
+}
+
+// checkUsage checks the totals of the nodes if ConsistencyCheck is set
+func (gr *GloalReserve) checkUsage(nodes []*NodeResInfo) {
+	if !gr.ConsistencyCheck {
+		return
+	}
+	for _, nodeInfo := range nodes {
+		if err := nodeInfo.CheckUsage(); err != nil {
+			klog.Errorf("%s, repaired", err.Error())
+		}
+	}
+}
+
+// podNode returns the node the pod is reserved or bound on
+func (gr *GloalReserve) podNode(uid types.UID) (string, bool) {
+	gr.podMu.Lock()
+	defer gr.podMu.Unlock()
+
+	nodeName, ok := gr.PodToNode[uid]
+	return nodeName, ok
+}
+
+// setPodNode saves the node the pod is reserved or bound on
+func (gr *GloalReserve) setPodNode(uid types.UID, nodeName string) {
+	gr.podMu.Lock()
+	defer gr.podMu.Unlock()
+
+	gr.PodToNode[uid] = nodeName
+}
+
+// deletePodNode forgets the node of the pod
+func (gr *GloalReserve) deletePodNode(uid types.UID) {
+	gr.podMu.Lock()
+	defer gr.podMu.Unlock()
+
+	delete(gr.PodToNode, uid)
+}
+
+// deletePodNodeOn forgets the node of the pod if it is nodeName, the index set by another node is
+// kept. The node must be locked.
+func (gr *GloalReserve) deletePodNodeOn(uid types.UID, nodeName string) {
+	gr.podMu.Lock()
+	defer gr.podMu.Unlock()
+
+	if gr.PodToNode[uid] == nodeName {
+		delete(gr.PodToNode, uid)
+	}
+}
+
+// nodeLocal returns true if reserving the pods on the nodes only reads and changes the nodes. The
+// pools held by bookings and the scheduler quotas are shared by many nodes, such pods need
+// GloalReserve.mu write locked.
+func (gr *GloalReserve) nodeLocal(pods []*v1.Pod, nodes []*NodeResInfo, now time.Time) bool {
+	for _, pod := range pods {
+		if _, ok := gr.Quotas[podSchedulerName(pod)]; ok {
+			return false
+		}
+	}
+
+	for _, b := range gr.activeBookings(now) {
+		if len(b.Pool) == 0 {
+			continue
+		}
+		for _, nodeInfo := range nodes {
+			if nodeInfo.Pool == b.Pool {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// newNodeReserveState creates a reserveState at the time now for the locked nodes, only the
+// placeholders and reservations expired on these nodes are removed
+func (gr *GloalReserve) newNodeReserveState(now time.Time, nodes []*NodeResInfo) *reserveState {
+	for _, nodeInfo := range nodes {
+		nodeInfo.expirePlaceholders(now)
+		gr.expireNodeReservations(nodeInfo, now)
+	}
+	return gr.reserveStateAt(now)
+}
@@ -0,0 +1,180 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// getNodes returns n nodes with cpu cores each for concurrency tests and benchmarks
+func getNodes(n int, cpu int64) []*v1.Node {
+	nodes := make([]*v1.Node, n)
+	for i := range nodes {
+		name := fmt.Sprintf("node%d", i)
+		nodes[i] = &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(name)},
+			Status: v1.NodeStatus{
+				Allocatable: v1.ResourceList{
+					v1.ResourceCPU:    *resource.NewQuantity(cpu, resource.DecimalSI),
+					v1.ResourceMemory: *resource.NewQuantity(cpu*1000, resource.DecimalSI),
+				},
+			},
+		}
+	}
+	return nodes
+}
+
+func TestNodeLock(t *testing.T) {
+	t.Run("NodeLock one node is not overcommitted", func(t *testing.T) {
+		gr := InitGR(getNodes(1, 10), nil, true)
+
+		var reserved int32
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if ret := gr.Reserve(GetPod(fmt.Sprintf("pod%d", i), "1", "100", "node0", v1.PodPending), "node0"); len(ret) == 0 {
+					atomic.AddInt32(&reserved, 1)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if reserved != 10 || len(gr.PodToNode) != 10 || gr.NodeCache["node0"].GetAvailable()[gr.ResTypeToID[v1.ResourceCPU]] != 0 {
+			t.Errorf("one node failed, %d pods are reserved", reserved)
+		}
+	})
+
+	t.Run("NodeLock batches in opposite orders", func(t *testing.T) {
+		gr := InitGR(getNodes(2, 100), nil, true)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				nodeNames := []string{"node0", "node1"}
+				if i%2 == 1 {
+					nodeNames = []string{"node1", "node0"}
+				}
+				pods := []*v1.Pod{
+					GetPod(fmt.Sprintf("pod%d-0", i), "1", "100", nodeNames[0], v1.PodPending),
+					GetPod(fmt.Sprintf("pod%d-1", i), "1", "100", nodeNames[1], v1.PodPending),
+				}
+				gr.ReservePods(pods, nodeNames)
+				gr.UnreservePods(pods[:1], nodeNames[:1])
+			}(i)
+		}
+		wg.Wait()
+
+		if len(gr.PodToNode) != 50 || len(gr.NodeCache["node0"].Pods) != 25 || len(gr.NodeCache["node1"].Pods) != 25 {
+			t.Errorf("opposite orders failed")
+		}
+	})
+
+	t.Run("NodeLock used follows pod status", func(t *testing.T) {
+		pod0 := GetPod("pod0", "1", "100", "node0", v1.PodRunning)
+		gr := InitGR(getNodes(1, 10), []*v1.Pod{pod0}, true)
+		cpu := gr.ResTypeToID[v1.ResourceCPU]
+		if gr.NodeCache["node0"].Requested[cpu] != 1000 {
+			t.Errorf("used failed")
+		}
+
+		succeeded := GetPod("pod0", "1", "100", "node0", v1.PodSucceeded)
+		gr.UpdatePod(pod0, succeeded)
+		if gr.NodeCache["node0"].Requested[cpu] != 0 {
+			t.Errorf("used of succeeded pod failed")
+		}
+
+		gr.DeletePod(succeeded)
+		if gr.NodeCache["node0"].Requested[cpu] != 0 || len(gr.NodeCache["node0"].Pods) != 0 {
+			t.Errorf("used of deleted pod failed")
+		}
+	})
+}
+
+// benchmarkReserve reserves and unreserves pods on random nodes from b.N goroutines, the feasible
+// nodes of every pod are queried first if prefilter is set. Run it with -cpu 1,2,4,8 to see how the
+// throughput scales with the cores.
+func benchmarkReserve(b *testing.B, gr *GloalReserve, nodes int, batch int, prefilter bool) {
+	var seq int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := atomic.AddInt64(&seq, 1)
+			pods := make([]*v1.Pod, batch)
+			nodeNames := make([]string, batch)
+			for j := range pods {
+				nodeNames[j] = fmt.Sprintf("node%d", (int(i)*batch+j*7919)%nodes)
+				pods[j] = GetPod(fmt.Sprintf("pod%d-%d", i, j), "100m", "100", nodeNames[j], v1.PodPending)
+				if prefilter {
+					if _, err := gr.FeasibleNodes(pods[j]); err != nil {
+						b.Fatalf("feasible nodes failed: %s", err.Error())
+					}
+				}
+			}
+			if ret := gr.ReservePods(pods, nodeNames); len(ret.Error) > 0 {
+				b.Fatalf("reserve failed: %s", ret.Error)
+			}
+			gr.UnreservePods(pods, nodeNames)
+		}
+	})
+}
+
+func BenchmarkReservePods(b *testing.B) {
+	for _, batch := range []int{1, 8} {
+		b.Run(fmt.Sprintf("nodes=1000/batch=%d", batch), func(b *testing.B) {
+			benchmarkReserve(b, InitGR(getNodes(1000, 1000), nil, true), 1000, batch, false)
+		})
+	}
+
+	// every pod is checked by PreFilter before it is reserved
+	b.Run("nodes=1000/batch=1/prefilter", func(b *testing.B) {
+		benchmarkReserve(b, InitGR(getNodes(1000, 1000), nil, true), 1000, 1, true)
+	})
+
+	// quotas are shared by all nodes, these batches take the whole cache lock
+	b.Run("nodes=1000/batch=1/quota", func(b *testing.B) {
+		gr := InitGR(getNodes(1000, 1000), nil, true)
+		gr.Quotas = map[string]v1.ResourceList{
+			ReserveSchedulerName: {v1.ResourceCPU: *resource.NewQuantity(1000000, resource.DecimalSI)},
+		}
+		benchmarkReserve(b, gr, 1000, 1, false)
+	})
+}
+
+func BenchmarkGetAvailable(b *testing.B) {
+	pods := make([]*v1.Pod, 1000)
+	for i := range pods {
+		pods[i] = GetPod(fmt.Sprintf("pod%d", i), "10m", "10", "node0", v1.PodRunning)
+	}
+	nodeInfo := InitGR(getNodes(1, 1000), pods, true).NodeCache["node0"]
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		nodeInfo.GetAvailable()
+	}
+}
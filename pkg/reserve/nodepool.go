@@ -0,0 +1,205 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog"
+)
+
+// NodePoolConf describes a group of nodes selected by labels, the settings of the first matching
+// pool override the cluster wide settings
+type NodePoolConf struct {
+	Name string `json:"name"`
+	// label selector of the nodes in this pool, e.g. "pool=dev,zone!=z1"
+	Selector string `json:"selector"`
+	// positive overcommit ratios by resource name, e.g. {"cpu": 4.0}
+	Overcommit map[v1.ResourceName]float64 `json:"overcommit,omitempty"`
+	// resources never reserved on every node, e.g. {"cpu": "1", "memory": "5%"}
+	Headroom map[v1.ResourceName]string `json:"headroom,omitempty"`
+	// resources on every node only reserved by pods with priority higher than EmergencyPriority
+	Emergency map[v1.ResourceName]string `json:"emergency,omitempty"`
+	// priority threshold of the emergency resources
+	EmergencyPriority *int32 `json:"emergencyPriority,omitempty"`
+}
+
+// NodePool is a parsed NodePoolConf
+type NodePool struct {
+	Name              string
+	Selector          labels.Selector
+	Overcommit        map[v1.ResourceName]float64
+	Headroom          map[v1.ResourceName]string
+	Emergency         map[v1.ResourceName]string
+	EmergencyPriority *int32
+}
+
+// NewNodePool parses one pool configuration
+func NewNodePool(conf *NodePoolConf) (*NodePool, error) {
+	selector, err := labels.Parse(conf.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("node pool %q has an invalid selector: %s", conf.Name, err.Error())
+	}
+
+	for resName, ratio := range conf.Overcommit {
+		if !(ratio > 0) || math.IsInf(ratio, 1) {
+			return nil, fmt.Errorf("node pool %q has an invalid overcommit ratio %s: %v", conf.Name, resName, ratio)
+		}
+	}
+
+	percents := make(map[v1.ResourceName]float64)
+	for _, buffer := range []map[v1.ResourceName]string{conf.Headroom, conf.Emergency} {
+		for resName, value := range buffer {
+			_, percent, err := parseBuffer(value)
+			if err != nil {
+				return nil, fmt.Errorf("node pool %q has an invalid buffer %s: %s", conf.Name, resName, err.Error())
+			}
+			if percent > 0 {
+				percents[resName] += percent
+			}
+		}
+	}
+	for resName, percent := range percents {
+		if percent > 100 {
+			return nil, fmt.Errorf("node pool %q has headroom and emergency %s exceeding the capacity", conf.Name, resName)
+		}
+	}
+
+	return &NodePool{
+		Name:              conf.Name,
+		Selector:          selector,
+		Overcommit:        conf.Overcommit,
+		Headroom:          conf.Headroom,
+		Emergency:         conf.Emergency,
+		EmergencyPriority: conf.EmergencyPriority,
+	}, nil
+}
+
+// NewNodePools parses the pool configurations
+func NewNodePools(confs []NodePoolConf) ([]*NodePool, error) {
+	pools := make([]*NodePool, 0, len(confs))
+	for i := range confs {
+		pool, err := NewNodePool(&confs[i])
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+
+	return pools, nil
+}
+
+// MatchNodePool returns the first pool selecting the node, nil if no pool matches
+func MatchNodePool(pools []*NodePool, node *v1.Node) *NodePool {
+	for _, pool := range pools {
+		if pool.Selector.Matches(labels.Set(node.Labels)) {
+			return pool
+		}
+	}
+
+	return nil
+}
+
+// SetOvercommit multiplies the raw capacity by the ratios, the ratios of the pool override the
+// cluster wide ratios in defaults, resources without ratio are not overcommitted
+func (nr *NodeResInfo) SetOvercommit(defaults *NodePool, pool *NodePool, resIDMap map[v1.ResourceName]int) {
+	copy(nr.Capa, nr.RawCapa)
+
+	for _, p := range []*NodePool{defaults, pool} {
+		if p == nil {
+			continue
+		}
+		for resName, ratio := range p.Overcommit {
+			if resIndex, ok := resIDMap[resName]; ok {
+				nr.Capa[resIndex] = int64(float64(nr.RawCapa[resIndex]) * ratio)
+			}
+		}
+	}
+}
+
+// SetHeadroom calculates the headroom and emergency resources from the effective capacity, the
+// settings of the pool override the cluster wide settings in defaults
+func (nr *NodeResInfo) SetHeadroom(defaults *NodePool, pool *NodePool, resIDMap map[v1.ResourceName]int) {
+	nr.Headroom = make([]int64, len(nr.Capa))
+	nr.Emergency = make([]int64, len(nr.Capa))
+	nr.EmergencyPriority = 0
+
+	for _, p := range []*NodePool{defaults, pool} {
+		if p == nil {
+			continue
+		}
+		setBuffer(nr.Headroom, p.Headroom, nr.Capa, resIDMap)
+		setBuffer(nr.Emergency, p.Emergency, nr.Capa, resIDMap)
+		if p.EmergencyPriority != nil {
+			nr.EmergencyPriority = *p.EmergencyPriority
+		}
+	}
+
+	//headroom and emergency can not exceed the capacity, or the available resources are negative
+	for i := range nr.Capa {
+		if nr.Headroom[i]+nr.Emergency[i] <= nr.Capa[i] {
+			continue
+		}
+		klog.Warningf("Headroom %d and emergency %d of node %s exceed the capacity %d, they are clamped",
+			nr.Headroom[i], nr.Emergency[i], nr.Name, nr.Capa[i])
+		if nr.Headroom[i] > nr.Capa[i] {
+			nr.Headroom[i] = nr.Capa[i]
+		}
+		nr.Emergency[i] = nr.Capa[i] - nr.Headroom[i]
+	}
+}
+
+// setBuffer translates the buffer settings into resVec, the percentages are based on capa
+func setBuffer(resVec resVector, buffer map[v1.ResourceName]string, capa resVector, resIDMap map[v1.ResourceName]int) {
+	for resName, value := range buffer {
+		resIndex, ok := resIDMap[resName]
+		if !ok {
+			continue
+		}
+
+		quantity, percent, err := parseBuffer(value)
+		if err != nil {
+			klog.Errorf("Invalid buffer %s: %s", resName, err.Error())
+			continue
+		}
+		if percent >= 0 {
+			resVec[resIndex] = int64(float64(capa[resIndex]) * percent / 100)
+		} else {
+			resVec[resIndex] = QuantityToInt(resName, quantity)
+		}
+	}
+}
+
+// parseBuffer parses a quantity like "1" or a percentage like "5%", percent is -1 for a quantity
+func parseBuffer(value string) (quantity resource.Quantity, percent float64, err error) {
+	if strings.HasSuffix(value, "%") {
+		percent, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err == nil && (percent < 0 || percent > 100) {
+			err = fmt.Errorf("percentage %s is out of range", value)
+		}
+		return quantity, percent, err
+	}
+
+	quantity, err = resource.ParseQuantity(value)
+	return quantity, -1, err
+}
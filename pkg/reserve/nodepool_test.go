@@ -0,0 +1,212 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"math"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestNewNodePools(t *testing.T) {
+	t.Run("NodePools invalid selector", func(t *testing.T) {
+		_, err := NewNodePools([]NodePoolConf{{Name: "dev", Selector: "pool in dev"}})
+		if err == nil {
+			t.Errorf("invalid selector failed")
+		}
+	})
+
+	t.Run("NodePools invalid overcommit", func(t *testing.T) {
+		for _, ratio := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+			_, err := NewNodePools([]NodePoolConf{{Name: "dev", Overcommit: map[v1.ResourceName]float64{v1.ResourceCPU: ratio}}})
+			if err == nil {
+				t.Errorf("invalid overcommit %v failed", ratio)
+			}
+		}
+		conf := &GRConf{}
+		conf.SetDefaults()
+		conf.Overcommit = map[v1.ResourceName]float64{v1.ResourceCPU: 0}
+		if err := conf.Validate(); err == nil {
+			t.Errorf("invalid overcommit conf failed")
+		}
+	})
+
+	t.Run("NodePools matching", func(t *testing.T) {
+		pools, err := NewNodePools([]NodePoolConf{
+			{Name: "dev", Selector: "pool=dev"},
+			{Name: "all", Selector: ""},
+		})
+		node0 := GetNode0()
+		node0.Labels = map[string]string{"pool": "dev"}
+		node1 := GetNode1()
+		if err != nil || MatchNodePool(pools, node0).Name != "dev" || MatchNodePool(pools, node1).Name != "all" {
+			t.Errorf("matching failed")
+		}
+	})
+}
+
+func TestOvercommit(t *testing.T) {
+	node0 := GetNode0()
+	node0.Labels = map[string]string{"pool": "dev"}
+	node1 := GetNode1()
+
+	gr := InitGR([]*v1.Node{node0, node1}, nil, false)
+	gr.Configure(&GRConf{
+		Overcommit: map[v1.ResourceName]float64{v1.ResourceCPU: 1.5},
+		NodePools: []NodePoolConf{
+			{Name: "dev", Selector: "pool=dev", Overcommit: map[v1.ResourceName]float64{v1.ResourceCPU: 2}},
+		},
+	})
+	gr.CollectFromLister()
+
+	t.Run("Overcommit capacity", func(t *testing.T) {
+		cpuIndex := gr.ResTypeToID[v1.ResourceCPU]
+		memIndex := gr.ResTypeToID[v1.ResourceMemory]
+		n0 := gr.NodeCache["node0"]
+		n1 := gr.NodeCache["node1"]
+		if n0.Pool != "dev" || n0.RawCapa[cpuIndex] != 2000 || n0.Capa[cpuIndex] != 4000 || n0.Capa[memIndex] != 5000 ||
+			n1.Pool != "" || n1.Capa[cpuIndex] != 3000 {
+			t.Errorf("overcommit capacity failed")
+		}
+	})
+
+	t.Run("Overcommit reserve", func(t *testing.T) {
+		pods := []*v1.Pod{
+			GetPod("pod0", "2", "1000", "node0", v1.PodPending),
+			GetPod("pod1", "2", "1000", "node0", v1.PodPending),
+		}
+		ret := gr.ReservePods(pods, []string{"node0", "node0"})
+		if len(ret.Error) > 0 {
+			t.Errorf("overcommit reserve failed")
+		}
+		if ret := gr.Reserve(GetPod("pod2", "1", "1000", "node0", v1.PodPending), "node0"); len(ret) == 0 {
+			t.Errorf("overcommit reserve error failed")
+		}
+	})
+
+	t.Run("Overcommit node status", func(t *testing.T) {
+		status, err := gr.GetNodeStatus("node0")
+		if err != nil {
+			t.Fatalf("node status failed with %s", err.Error())
+		}
+		rawCPU := status.Capacity[v1.ResourceCPU]
+		effectiveCPU := status.EffectiveCapacity[v1.ResourceCPU]
+		availableCPU := status.Available[v1.ResourceCPU]
+		if status.Pool != "dev" || rawCPU.MilliValue() != 2000 || effectiveCPU.MilliValue() != 4000 ||
+			availableCPU.MilliValue() != 0 {
+			t.Errorf("overcommit node status failed")
+		}
+		if _, err := gr.GetNodeStatus("node9"); err == nil {
+			t.Errorf("non-exist node status failed")
+		}
+	})
+
+	t.Run("Overcommit node leaves pool", func(t *testing.T) {
+		newNode0 := node0.DeepCopy()
+		newNode0.Labels = nil
+		gr.UpdateNode(node0, newNode0)
+		n0 := gr.NodeCache["node0"]
+		if n0.Pool != "" || n0.Capa[gr.ResTypeToID[v1.ResourceCPU]] != 3000 || len(n0.Pods) != 2 {
+			t.Errorf("node leaves pool failed")
+		}
+	})
+}
+
+func TestHeadroom(t *testing.T) {
+	t.Run("Headroom invalid percentage", func(t *testing.T) {
+		_, err := NewNodePool(&NodePoolConf{Name: "dev", Headroom: map[v1.ResourceName]string{v1.ResourceCPU: "150%"}})
+		if err == nil {
+			t.Errorf("invalid percentage failed")
+		}
+	})
+
+	t.Run("Headroom percentages exceed capacity", func(t *testing.T) {
+		_, err := NewNodePool(&NodePoolConf{Name: "dev", Headroom: map[v1.ResourceName]string{v1.ResourceCPU: "60%"},
+			Emergency: map[v1.ResourceName]string{v1.ResourceCPU: "50%"}})
+		if err == nil {
+			t.Errorf("percentages exceed capacity failed")
+		}
+	})
+
+	t.Run("Headroom quantities exceed capacity", func(t *testing.T) {
+		gr := InitGR([]*v1.Node{GetNode0()}, nil, false)
+		gr.Configure(&GRConf{
+			Headroom:  map[v1.ResourceName]string{v1.ResourceCPU: "1500m"},
+			Emergency: map[v1.ResourceName]string{v1.ResourceCPU: "1"},
+		})
+		gr.CollectFromLister()
+
+		nodeInfo := gr.NodeCache["node0"]
+		cpu := gr.ResTypeToID[v1.ResourceCPU]
+		if nodeInfo.Headroom[cpu] != 1500 || nodeInfo.Emergency[cpu] != nodeInfo.Capa[cpu]-1500 || nodeInfo.GetAvailable()[cpu] != 0 {
+			t.Errorf("quantities exceed capacity failed: %v %v %v", nodeInfo.Headroom, nodeInfo.Emergency, nodeInfo.GetAvailable())
+		}
+	})
+
+	gr := InitGR([]*v1.Node{GetNode0()}, nil, false)
+	gr.Configure(&GRConf{
+		Headroom:          map[v1.ResourceName]string{v1.ResourceCPU: "500m", v1.ResourceMemory: "10%"},
+		Emergency:         map[v1.ResourceName]string{v1.ResourceCPU: "500m"},
+		EmergencyPriority: 100,
+	})
+	gr.CollectFromLister()
+
+	var highPriority int32 = 1000
+	pod0 := GetPod("pod0", "1", "1000", "node0", v1.PodPending)
+	pod1 := GetPod("pod1", "500m", "1000", "node0", v1.PodPending)
+	pod2 := GetPod("pod2", "500m", "1000", "node0", v1.PodPending)
+	pod2.Spec.Priority = &highPriority
+	pod3 := GetPod("pod3", "500m", "1000", "node0", v1.PodPending)
+	pod3.Spec.Priority = &highPriority
+
+	t.Run("Headroom available", func(t *testing.T) {
+		nodeAvai := gr.NodeCache["node0"].GetAvailable()
+		if nodeAvai[gr.ResTypeToID[v1.ResourceCPU]] != 1000 || nodeAvai[gr.ResTypeToID[v1.ResourceMemory]] != 4500 {
+			t.Errorf("headroom available failed")
+		}
+	})
+
+	t.Run("Headroom reserve success", func(t *testing.T) {
+		if ret := gr.Reserve(pod0, "node0"); len(ret) > 0 {
+			t.Errorf("headroom reserve success failed")
+		}
+	})
+
+	t.Run("Headroom low priority pod can not use emergency", func(t *testing.T) {
+		if ret := gr.Reserve(pod1, "node0"); len(ret) == 0 {
+			t.Errorf("low priority pod failed")
+		}
+		ret := gr.ReservePods([]*v1.Pod{pod1}, []string{"node0"})
+		if len(ret.Error) == 0 {
+			t.Errorf("low priority pods failed")
+		}
+	})
+
+	t.Run("Headroom high priority pod uses emergency", func(t *testing.T) {
+		ret := gr.ReservePods([]*v1.Pod{pod2}, []string{"node0"})
+		if len(ret.Error) > 0 {
+			t.Errorf("high priority pod failed")
+		}
+	})
+
+	t.Run("Headroom high priority pod can not use headroom", func(t *testing.T) {
+		if ret := gr.Reserve(pod3, "node0"); len(ret) == 0 {
+			t.Errorf("high priority pod headroom failed")
+		}
+	})
+}
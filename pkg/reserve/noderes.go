@@ -17,6 +17,10 @@
 package reserve
 
 import (
+	"fmt"
+	"math"
+	"sync"
+
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/klog"
 
@@ -25,90 +29,305 @@ import (
 
 // NodeResInfo saves node data in GloalReserve.NodeCache
 type NodeResInfo struct {
-	Name string
-	Capa resVector
-	Pods map[types.UID]*PodResInfo
+	Name    string
+	Labels  map[string]string
+	Pool    string         // the matching node pool, empty if no pool selects this node
+	RawCapa resVector      // capacity reported by the node
+	Capa    resVector      // effective capacity after overcommit
+	Zones   []*ZoneResInfo // optional NUMA zones sorted by name, nil if the node does not report them
+	Pods    map[types.UID]*PodResInfo
+
+	// zones set by GloalReserve.SetNodeZones, kept by node updates without NUMAZonesAnnotation
+	fedZones map[string]v1.ResourceList
+
+	// running totals of Pods, succeeded and failed pods are not counted, see CheckUsage
+	Requested resVector // requests of the bound pods
+	Reserved  resVector // requests of the pods reserved but not bound yet
+	// key: scheduler name, requests of the reserved and bound pods of the scheduler, see PodResInfo.Source
+	SchedulerUsage map[string]resVector
+
+	// mu guards Pods, Requested, Reserved, SchedulerUsage and Placeholders when GloalReserve.mu is only read locked
+	mu sync.Mutex
+
+	Placeholders map[string]*placeholderInfo // key: claim token, anonymous resources waiting for pods
+
+	Headroom          resVector // never reserved by any pod
+	Emergency         resVector // only reserved by pods with priority higher than EmergencyPriority
+	EmergencyPriority int32
 }
 
 // NewNodeResInfo create a NodeResInfo by v1.Node
 func NewNodeResInfo(node *v1.Node, resIDMap map[v1.ResourceName]int, resVecLen int) *NodeResInfo {
+	nr := newNodeResInfoWithCapa(node, node.Status.Allocatable, resIDMap, resVecLen)
+	nr.SetZones(GetNodeZones(node), resIDMap)
+
+	return nr
+}
+
+// newNodeResInfoWithCapa create a NodeResInfo by v1.Node and its capacity
+func newNodeResInfoWithCapa(node *v1.Node, capa v1.ResourceList, resIDMap map[v1.ResourceName]int, resVecLen int) *NodeResInfo {
 	// Nodes' res map to vectors [0 0 0 100 300 100 0]
 	resources := make([]int64, resVecLen)
-	for resName, resValue := range node.Status.Allocatable {
-		resIndex := resIDMap[resName]
-		resources[resIndex] = QuantityToInt(resName, resValue)
-	}
+	ResourceListToVector(capa, resIDMap, resources)
+
+	rawResources := make([]int64, resVecLen)
+	copy(rawResources, resources)
 
 	return &NodeResInfo{
-		Name: node.Name,
-		Capa: resources,
-		Pods: make(map[types.UID]*PodResInfo),
+		Name:      node.Name,
+		Labels:    node.Labels,
+		RawCapa:   rawResources,
+		Capa:      resources,
+		Pods:      make(map[types.UID]*PodResInfo),
+		Requested: make([]int64, resVecLen),
+		Reserved:  make([]int64, resVecLen),
+
+		SchedulerUsage: make(map[string]resVector),
+
+		Headroom:  make([]int64, resVecLen),
+		Emergency: make([]int64, resVecLen),
 	}
 }
 
 // Dump for debugging
 func (nr *NodeResInfo) Dump() {
-	klog.Infof("    %s : %v", nr.Name, nr.Capa)
+	klog.Infof("    %s (pool %q) : %v, raw %v, headroom %v, emergency %v, requested %v, reserved %v", nr.Name, nr.Pool,
+		nr.Capa, nr.RawCapa, nr.Headroom, nr.Emergency, nr.Requested, nr.Reserved)
+	for _, zone := range nr.Zones {
+		klog.Infof("      zone %s : %v", zone.Name, zone.Capa)
+	}
 	for _, podR := range nr.Pods {
 		podR.Dump()
 	}
+	for token, ph := range nr.Placeholders {
+		klog.Infof("        placeholder %s until %v : %v", token, ph.Expires, ph.remaining)
+	}
 }
 
 // AddPodToCache adds one pod into this NodeResInfo
 func (nr *NodeResInfo) AddPodToCache(pod *v1.Pod, resIDMap map[v1.ResourceName]int) {
+	podReq := make([]int64, len(nr.Capa))
+	GetPodReq(pod, resIDMap, podReq)
+	nr.AddPodReqToCache(pod, podReq)
+}
+
+// AddPodReqToCache adds one pod with its translated requests into this NodeResInfo
+func (nr *NodeResInfo) AddPodReqToCache(pod *v1.Pod, podReq resVector) {
 	// AddPod does not check node's avilable resources, assue the pod can be binded to this node
 	podKey := pod.UID
 
-	nr.Pods[podKey] = NewPodInfo(pod, resIDMap, cap(nr.Capa))
+	nr.removePod(podKey)
+	podInfo := newPodInfoWithReq(pod, podReq)
+	nr.Pods[podKey] = podInfo
+	nr.addUsage(podInfo)
 	klog.V(3).Infof("Add pod %s on node %s", podKey, nr.Name)
 	klog.V(4).Infof("Available: %v", nr.GetAvailable())
 }
 
-// UpdatePod updates one pod in this NodeResInfo
-func (nr *NodeResInfo) UpdatePod(pod *v1.Pod, resIDMap map[v1.ResourceName]int) {
+// UpdatePodReq updates the phase and the translated requests of one pod in this NodeResInfo, the
+// requests are changed when the pod is resized in place. A reserved pod is only marked bound once
+// its Spec.NodeName is set. It returns the overcommitted resources if
+// the pod is resized up beyond the available resources, nil otherwise.
+func (nr *NodeResInfo) UpdatePodReq(pod *v1.Pod, podReq resVector) resVector {
 	podKey := pod.UID
-	if podInfo, ok := nr.Pods[pod.UID]; ok {
-		podInfo.Status = pod.Status.Phase
-		klog.V(3).Infof("Update pod %s on node %s", podKey, nr.Name)
-	} else {
-		klog.V(3).Infof("Pod %s can not be found on host %s", pod.Name, nr.Name)
+	podInfo, ok := nr.Pods[pod.UID]
+	if !ok {
+		klog.V(3).Infof("Pod %s can not be found on host %s", PodKey(pod), nr.Name)
+		return nil
 	}
 
+	oldReq := podInfo.Resources
+	nr.removeUsage(podInfo)
+	podInfo.Status = pod.Status.Phase
+	if len(pod.Spec.NodeName) > 0 {
+		podInfo.State = BoundState
+	}
+	podInfo.Resources = podReq
+	nr.addUsage(podInfo)
+	klog.V(3).Infof("Update pod %s on node %s", podKey, nr.Name)
 	klog.V(4).Infof("Available: %v", nr.GetAvailable())
+
+	if nr.usage(podInfo) == nil || VectorEqual(oldReq, podReq) {
+		return nil
+	}
+	klog.V(3).Infof("Pod %s on node %s is resized from %v to %v", podKey, nr.Name, oldReq, podReq)
+
+	// only the resources grown by the resize are overcommitted by it
+	var over resVector
+	for i, v := range nr.GetAvailableByPriority(GetPodPriority(pod)) {
+		if v < 0 && i < len(oldReq) && podReq[i] > oldReq[i] {
+			if over == nil {
+				over = make([]int64, len(podReq))
+			}
+			over[i] = -v
+		}
+	}
+	return over
 }
 
 // DeletePod deletes the pod from this NodeResInfo
 func (nr *NodeResInfo) DeletePod(pod *v1.Pod) {
 	podKey := pod.UID
-	if _, ok := nr.Pods[podKey]; ok {
+	if nr.removePod(podKey) {
 		klog.V(3).Infof("Delete pod %s from node %s", podKey, nr.Name)
-		delete(nr.Pods, podKey)
 	}
 
 	klog.V(4).Infof("Available: %v", nr.GetAvailable())
 }
 
+// removePod removes the pod from Pods and the totals, returns false if the pod is not on this node
+func (nr *NodeResInfo) removePod(uid types.UID) bool {
+	podInfo, ok := nr.Pods[uid]
+	if !ok {
+		return false
+	}
+	nr.removeUsage(podInfo)
+	delete(nr.Pods, uid)
+	return true
+}
+
+// setPodState changes the state of a pod in Pods and moves its requests between the totals
+func (nr *NodeResInfo) setPodState(podInfo *PodResInfo, state string) {
+	nr.removeUsage(podInfo)
+	podInfo.State = state
+	nr.addUsage(podInfo)
+}
+
+// usage returns the total counting the pod, nil if the pod is succeeded or failed
+func (nr *NodeResInfo) usage(podInfo *PodResInfo) resVector {
+	if podInfo.Status == v1.PodSucceeded || podInfo.Status == v1.PodFailed {
+		return nil
+	}
+	if podInfo.State == ReservedState {
+		return nr.Reserved
+	}
+	return nr.Requested
+}
+
+// addUsage adds the requests of the pod into its totals
+func (nr *NodeResInfo) addUsage(podInfo *PodResInfo) {
+	if total := nr.usage(podInfo); total != nil {
+		VectorAdd(total, podInfo.Resources)
+		schedulerUsage, ok := nr.SchedulerUsage[podInfo.Source]
+		if !ok {
+			schedulerUsage = make([]int64, len(nr.Requested))
+			nr.SchedulerUsage[podInfo.Source] = schedulerUsage
+		}
+		VectorAdd(schedulerUsage, podInfo.Resources)
+	}
+}
+
+// removeUsage subtracts the requests of the pod from its totals
+func (nr *NodeResInfo) removeUsage(podInfo *PodResInfo) {
+	if total := nr.usage(podInfo); total != nil {
+		VectorMinus(total, podInfo.Resources)
+		if schedulerUsage, ok := nr.SchedulerUsage[podInfo.Source]; ok {
+			VectorMinus(schedulerUsage, podInfo.Resources)
+			if isEmptyVector(schedulerUsage) {
+				delete(nr.SchedulerUsage, podInfo.Source)
+			}
+		}
+	}
+}
+
+// computeUsage sums the requests of Pods from scratch
+func (nr *NodeResInfo) computeUsage() (requested resVector, reserved resVector, schedulerUsage map[string]resVector) {
+	requested = make([]int64, len(nr.Requested))
+	reserved = make([]int64, len(nr.Reserved))
+	schedulerUsage = make(map[string]resVector)
+	for _, podInfo := range nr.Pods {
+		if podInfo.Status == v1.PodSucceeded || podInfo.Status == v1.PodFailed {
+			continue
+		}
+		if podInfo.State == ReservedState {
+			VectorAdd(reserved, podInfo.Resources)
+		} else {
+			VectorAdd(requested, podInfo.Resources)
+		}
+		if _, ok := schedulerUsage[podInfo.Source]; !ok {
+			schedulerUsage[podInfo.Source] = make([]int64, len(nr.Requested))
+		}
+		VectorAdd(schedulerUsage[podInfo.Source], podInfo.Resources)
+	}
+	for schedulerName, usage := range schedulerUsage {
+		if isEmptyVector(usage) {
+			delete(schedulerUsage, schedulerName)
+		}
+	}
+	return requested, reserved, schedulerUsage
+}
+
+// CheckUsage recomputes the totals from Pods, it returns an error and repairs the totals if they
+// are different
+func (nr *NodeResInfo) CheckUsage() error {
+	requested, reserved, schedulerUsage := nr.computeUsage()
+	if VectorEqual(requested, nr.Requested) && VectorEqual(reserved, nr.Reserved) &&
+		schedulerUsageEqual(schedulerUsage, nr.SchedulerUsage) {
+		return nil
+	}
+
+	err := fmt.Errorf("usage of node %s is inconsistent: requested %v, expected %v, reserved %v, expected %v, "+
+		"scheduler usage %v, expected %v", nr.Name, nr.Requested, requested, nr.Reserved, reserved, nr.SchedulerUsage, schedulerUsage)
+	nr.Requested = requested
+	nr.Reserved = reserved
+	nr.SchedulerUsage = schedulerUsage
+	return err
+}
+
+// schedulerUsageEqual returns true if a and b have the same schedulers and usage
+func schedulerUsageEqual(a map[string]resVector, b map[string]resVector) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for schedulerName, usage := range a {
+		if !VectorEqual(usage, b[schedulerName]) {
+			return false
+		}
+	}
+	return true
+}
+
 // CheckPod checks there is enough resources in this NodeResInfo
 func (nr *NodeResInfo) CheckPod(pod *v1.Pod, resIDMap map[v1.ResourceName]int) bool {
-	nodeAvailable := nr.GetAvailable()
-	klog.V(3).Infof("CheckPod availabe: %v", nodeAvailable)
 	podReq := make([]int64, len(nr.Capa))
 	GetPodReq(pod, resIDMap, podReq)
+
+	return nr.CheckReq(podReq, GetPodPriority(pod))
+}
+
+// CheckReq checks there is enough resources in this NodeResInfo for the translated pod requests
+func (nr *NodeResInfo) CheckReq(podReq resVector, priority int32) bool {
+	nodeAvailable := nr.GetAvailableByPriority(priority)
+	klog.V(3).Infof("CheckPod availabe: %v", nodeAvailable)
 	klog.V(3).Infof("pod request: %v", podReq)
 
 	return VectorCompare(nodeAvailable, podReq)
 }
 
-// GetAvailable caculate the free resources in this NodeResInfo, succeeded and failed pods are ignored
+// GetAvailable caculate the free resources in this NodeResInfo for the pods not allowed to use the
+// emergency resources
 func (nr *NodeResInfo) GetAvailable() []int64 {
+	return nr.GetAvailableByPriority(math.MinInt32)
+}
+
+// CanUseEmergency returns true if a pod with this priority can use the emergency resources
+func (nr *NodeResInfo) CanUseEmergency(priority int32) bool {
+	return priority > nr.EmergencyPriority
+}
+
+// GetAvailableByPriority caculate the free resources in this NodeResInfo for a pod with this priority,
+// the headroom and the unclaimed placeholders are never available, succeeded and failed pods are not counted
+func (nr *NodeResInfo) GetAvailableByPriority(priority int32) []int64 {
 	avaiRes := make([]int64, cap(nr.Capa))
 	copy(avaiRes, nr.Capa)
-	for _, pod := range nr.Pods {
-		if pod.Status != v1.PodSucceeded && pod.Status != v1.PodFailed {
-			for i, v := range pod.Resources {
-				avaiRes[i] -= v
-			}
-		}
+	VectorMinus(avaiRes, nr.Headroom)
+	if !nr.CanUseEmergency(priority) {
+		VectorMinus(avaiRes, nr.Emergency)
+	}
+	VectorMinus(avaiRes, nr.Requested)
+	VectorMinus(avaiRes, nr.Reserved)
+	for _, ph := range nr.Placeholders {
+		VectorMinus(avaiRes, ph.remaining)
 	}
 
 	return avaiRes
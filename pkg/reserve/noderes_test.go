@@ -113,3 +113,41 @@ func TestCheckPod(t *testing.T) {
 		}
 	})
 }
+
+func TestUsage(t *testing.T) {
+	pod0 := GetPod("pod0", "1", "100", "node0", v1.PodRunning)
+	gr := InitGR([]*v1.Node{GetNode0()}, []*v1.Pod{pod0}, true)
+	nodeInfo := gr.NodeCache["node0"]
+	cpu := gr.ResTypeToID[v1.ResourceCPU]
+
+	pod1 := GetPod("pod1", "500m", "100", "node0", v1.PodPending)
+	t.Run("Usage reserved", func(t *testing.T) {
+		if ret := gr.Reserve(pod1, "node0"); len(ret) > 0 || nodeInfo.Requested[cpu] != 1000 || nodeInfo.Reserved[cpu] != 500 {
+			t.Errorf("reserved failed: %v %v", nodeInfo.Requested, nodeInfo.Reserved)
+		}
+	})
+
+	t.Run("Usage bound", func(t *testing.T) {
+		if err := gr.ConfirmBinding(pod1, "node0"); err != nil || nodeInfo.Requested[cpu] != 1500 || nodeInfo.Reserved[cpu] != 0 {
+			t.Errorf("bound failed: %v %v", nodeInfo.Requested, nodeInfo.Reserved)
+		}
+	})
+
+	t.Run("Usage failed", func(t *testing.T) {
+		gr.UpdatePod(pod0, GetPod("pod0", "1", "100", "node0", v1.PodFailed))
+		if nodeInfo.Requested[cpu] != 500 || nodeInfo.GetAvailable()[cpu] != 1500 {
+			t.Errorf("failed failed: %v", nodeInfo.Requested)
+		}
+	})
+
+	t.Run("Usage consistency check", func(t *testing.T) {
+		if errs := gr.CheckConsistency(); len(errs) != 0 {
+			t.Errorf("consistency check failed: %v", errs)
+		}
+
+		nodeInfo.Reserved[cpu] = 100
+		if errs := gr.CheckConsistency(); len(errs) != 1 || nodeInfo.Reserved[cpu] != 0 {
+			t.Errorf("consistency check of broken totals failed")
+		}
+	})
+}
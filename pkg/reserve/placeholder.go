@@ -0,0 +1,194 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// ClaimAnnotation is the pod annotation naming the placeholder claimed by the pod
+const ClaimAnnotation string = "globalreserve.ibm.com/claim"
+
+// DefaultPlaceholderTTL is used when the placeholder does not specify its TTL
+const DefaultPlaceholderTTL = 5 * time.Minute
+
+// Placeholder reserves anonymous resources on a node under a claim token before the pods exist.
+// The pods carrying the token take the resources over instead of being counted twice.
+type Placeholder struct {
+	Token      string
+	Node       string
+	Resources  v1.ResourceList
+	TTLSeconds int64     `json:",omitempty"` // 0 means GRConf.PlaceholderTTLSeconds
+	Expires    time.Time // set by GloalReserve
+	Owner      string    `json:",omitempty"` // which scheduler creates this placeholder
+}
+
+// PlaceholderResult placeholder http return data struct
+type PlaceholderResult struct {
+	Expires time.Time
+	Error   string
+	Reason  ErrorReason `json:",omitempty"` // reason of Error
+}
+
+// placeholderInfo saves a Placeholder in NodeResInfo.Placeholders
+type placeholderInfo struct {
+	*Placeholder
+	remaining resVector // not claimed yet
+}
+
+// claimPlaceholder moves the claimed part of the placeholder to the pod, the placeholder is
+// removed when nothing remains
+func (nr *NodeResInfo) claimPlaceholder(token string, podReq resVector) {
+	ph, ok := nr.Placeholders[token]
+	if !ok || len(token) == 0 {
+		return
+	}
+
+	VectorMinus(ph.remaining, take(ph.remaining, podReq))
+	if isEmptyVector(ph.remaining) {
+		klog.V(3).Infof("Placeholder %s on node %s is fully claimed", token, nr.Name)
+		delete(nr.Placeholders, token)
+	}
+}
+
+// expirePlaceholders removes the placeholders which are not claimed in time
+func (gr *GloalReserve) expirePlaceholders(now time.Time) {
+	for _, nodeInfo := range gr.NodeCache {
+		nodeInfo.expirePlaceholders(now)
+	}
+}
+
+// expirePlaceholders removes the placeholders on this node which are not claimed in time
+func (nr *NodeResInfo) expirePlaceholders(now time.Time) {
+	for token, ph := range nr.Placeholders {
+		if !now.Before(ph.Expires) {
+			klog.V(3).Infof("Placeholder %s on node %s is expired", token, nr.Name)
+			delete(nr.Placeholders, token)
+		}
+	}
+}
+
+// AddPlaceholder reserves the resources of the placeholder on its node, it returns the expiry time
+func (gr *GloalReserve) AddPlaceholder(placeholder *Placeholder) (time.Time, error) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	// nothing in the cache, collect all pods and nodes
+	if gr.NextResourceID == 0 {
+		gr.CollectFromLister()
+	}
+
+	if len(placeholder.Token) == 0 {
+		return time.Time{}, newReserveError(InvalidRequestReason, "placeholder token is not specified")
+	}
+	if len(placeholder.Resources) == 0 {
+		return time.Time{}, newReserveError(InvalidRequestReason, "placeholder %s does not hold any resource", placeholder.Token)
+	}
+	nodeInfo, ok := gr.NodeCache[placeholder.Node]
+	if !ok {
+		return time.Time{}, newReserveError(NodeNotFoundReason, "placeholder %s: node %s does not exist", placeholder.Token, placeholder.Node)
+	}
+	if _, ok := nodeInfo.Placeholders[placeholder.Token]; ok {
+		return time.Time{}, newReserveError(InvalidRequestReason, "placeholder %s already exists on node %s", placeholder.Token, placeholder.Node)
+	}
+
+	now := time.Now()
+	req := make([]int64, gr.ResTypeMaxKind)
+	ResourceListToVector(placeholder.Resources, gr.ResTypeToID, req)
+
+	// the placeholder is checked as an anonymous pod with the default priority
+	if _, fit := gr.newReserveState(now).fit(&v1.Pod{}, req, nodeInfo, false); !fit {
+		return time.Time{}, newReserveError(InsufficientResourcesReason, "placeholder %s: resource is not enough", placeholder.Token)
+	}
+
+	ttl := DefaultPlaceholderTTL
+	if gr.PlaceholderTTL > 0 {
+		ttl = gr.PlaceholderTTL
+	}
+	if placeholder.TTLSeconds > 0 {
+		ttl = time.Duration(placeholder.TTLSeconds) * time.Second
+	}
+	placeholder.Expires = now.Add(ttl)
+
+	if nodeInfo.Placeholders == nil {
+		nodeInfo.Placeholders = make(map[string]*placeholderInfo)
+	}
+	nodeInfo.Placeholders[placeholder.Token] = &placeholderInfo{Placeholder: placeholder, remaining: req}
+
+	klog.V(3).Infof("Add placeholder %s on node %s until %v", placeholder.Token, placeholder.Node, placeholder.Expires)
+	return placeholder.Expires, nil
+}
+
+// DeletePlaceholder releases the placeholders with the token on all nodes, returns false if none exists
+func (gr *GloalReserve) DeletePlaceholder(token string) bool {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	found := false
+	for _, nodeInfo := range gr.NodeCache {
+		if _, ok := nodeInfo.Placeholders[token]; ok {
+			klog.V(3).Infof("Delete placeholder %s from node %s", token, nodeInfo.Name)
+			delete(nodeInfo.Placeholders, token)
+			found = true
+		}
+	}
+
+	return found
+}
+
+// ListPlaceholders returns the placeholders which are not expired with their unclaimed resources,
+// sorted by token and node
+func (gr *GloalReserve) ListPlaceholders() []*Placeholder {
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	now := time.Now()
+	result := []*Placeholder{}
+	for _, nodeInfo := range gr.NodeCache {
+		nodeInfo.mu.Lock()
+		for _, ph := range nodeInfo.Placeholders {
+			if now.Before(ph.Expires) {
+				p := *ph.Placeholder
+				p.Resources = VectorToResourceList(ph.remaining, gr.ResTypeToID)
+				result = append(result, &p)
+			}
+		}
+		nodeInfo.mu.Unlock()
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Token != result[j].Token {
+			return result[i].Token < result[j].Token
+		}
+		return result[i].Node < result[j].Node
+	})
+	return result
+}
+
+// isEmptyVector returns true if there is no positive value in vec
+func isEmptyVector(vec []int64) bool {
+	for _, v := range vec {
+		if v > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// GetClaimingPod returns a pod claiming the placeholder
+func GetClaimingPod(name string, cpuStr string, nodename string, token string) *v1.Pod {
+	pod := GetPod(name, cpuStr, "100", nodename, v1.PodPending)
+	pod.Annotations = map[string]string{ClaimAnnotation: token}
+	return pod
+}
+
+func getCPUPlaceholder(token string, cpuStr string, nodename string) *Placeholder {
+	return &Placeholder{
+		Token:     token,
+		Node:      nodename,
+		Resources: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpuStr)},
+	}
+}
+
+func TestAddPlaceholder(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0()}, nil, true)
+
+	t.Run("AddPlaceholder without token", func(t *testing.T) {
+		if _, err := gr.AddPlaceholder(getCPUPlaceholder("", "1", "node0")); ReasonForError(err) != InvalidRequestReason {
+			t.Errorf("placeholder without token failed")
+		}
+	})
+
+	t.Run("AddPlaceholder with non-exist node", func(t *testing.T) {
+		if _, err := gr.AddPlaceholder(getCPUPlaceholder("job0", "1", "node9")); ReasonForError(err) != NodeNotFoundReason {
+			t.Errorf("placeholder with non-exist node failed")
+		}
+	})
+
+	t.Run("AddPlaceholder too much", func(t *testing.T) {
+		if _, err := gr.AddPlaceholder(getCPUPlaceholder("job0", "3", "node0")); ReasonForError(err) != InsufficientResourcesReason {
+			t.Errorf("placeholder too much failed")
+		}
+	})
+
+	t.Run("AddPlaceholder success", func(t *testing.T) {
+		expires, err := gr.AddPlaceholder(getCPUPlaceholder("job0", "1", "node0"))
+		if err != nil || expires.Before(time.Now().Add(DefaultPlaceholderTTL-time.Minute)) || len(gr.ListPlaceholders()) != 1 {
+			t.Errorf("placeholder success failed")
+		}
+	})
+
+	t.Run("AddPlaceholder duplicated", func(t *testing.T) {
+		if _, err := gr.AddPlaceholder(getCPUPlaceholder("job0", "500m", "node0")); err == nil {
+			t.Errorf("duplicated placeholder failed")
+		}
+	})
+
+	t.Run("DeletePlaceholder", func(t *testing.T) {
+		if !gr.DeletePlaceholder("job0") || gr.DeletePlaceholder("job0") || len(gr.ListPlaceholders()) != 0 {
+			t.Errorf("delete placeholder failed")
+		}
+	})
+}
+
+func TestReservePlaceholder(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0(), GetNode1()}, nil, true)
+	if _, err := gr.AddPlaceholder(getCPUPlaceholder("job0", "1500m", "node0")); err != nil {
+		t.Fatalf("adding placeholder failed with %s", err.Error())
+	}
+
+	t.Run("Reserve blocked by placeholder", func(t *testing.T) {
+		if ret := gr.Reserve(GetPod("pod0", "1", "100", "node0", v1.PodPending), "node0"); len(ret) == 0 {
+			t.Errorf("blocked by placeholder failed")
+		}
+	})
+
+	t.Run("Reserve claims placeholder", func(t *testing.T) {
+		if ret := gr.Reserve(GetClaimingPod("pod1", "1", "node0", "job0"), "node0"); len(ret) > 0 {
+			t.Errorf("claims placeholder failed")
+		}
+		list := gr.ListPlaceholders()
+		if len(list) != 1 || list[0].Resources.Cpu().MilliValue() != 500 {
+			t.Errorf("claims placeholder remaining failed")
+		}
+	})
+
+	t.Run("Reserve claims more than placeholder", func(t *testing.T) {
+		pod := GetPod("pod2", "1", "100", "node0", v1.PodPending)
+		ret := gr.ReservePods([]*v1.Pod{pod}, []string{"node0"})
+		if len(ret.Error) == 0 {
+			t.Errorf("claims more than placeholder error failed")
+		}
+		setClaims([]*v1.Pod{pod}, []string{"job0"})
+		ret = gr.ReservePods([]*v1.Pod{pod}, []string{"node0"})
+		if len(ret.Error) > 0 || len(gr.ListPlaceholders()) != 0 {
+			t.Errorf("claims more than placeholder failed")
+		}
+	})
+
+	t.Run("Reserve placeholder expired", func(t *testing.T) {
+		if _, err := gr.AddPlaceholder(getCPUPlaceholder("job1", "2", "node1")); err != nil {
+			t.Fatalf("adding placeholder failed with %s", err.Error())
+		}
+		if ret := gr.Reserve(GetPod("pod3", "1", "100", "node1", v1.PodPending), "node1"); len(ret) == 0 {
+			t.Errorf("placeholder not expired failed")
+		}
+		gr.NodeCache["node1"].Placeholders["job1"].Expires = time.Now()
+		if ret := gr.Reserve(GetPod("pod3", "1", "100", "node1", v1.PodPending), "node1"); len(ret) > 0 {
+			t.Errorf("placeholder expired failed")
+		}
+	})
+}
+
+func TestBoundPodClaimsPlaceholder(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0()}, nil, true)
+	if _, err := gr.AddPlaceholder(getCPUPlaceholder("job0", "1", "node0")); err != nil {
+		t.Fatalf("adding placeholder failed with %s", err.Error())
+	}
+
+	gr.AddPod(GetClaimingPod("pod0", "1", "node0", "job0"))
+	avai := gr.NodeCache["node0"].GetAvailable()
+	if len(gr.ListPlaceholders()) != 0 || avai[gr.ResTypeToID[v1.ResourceCPU]] != 1000 {
+		t.Errorf("bound pod claims placeholder failed")
+	}
+}
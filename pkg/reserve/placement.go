@@ -0,0 +1,198 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog"
+)
+
+// placement strategies picking a node for every pod
+const (
+	// FirstFitStrategy picks the first fitting node ordered by name
+	FirstFitStrategy string = "first-fit"
+	// BestFitStrategy picks the fitting node with the least free resources left, packing the pods
+	BestFitStrategy string = "best-fit"
+	// SpreadStrategy picks the fitting node with the most free resources left
+	SpreadStrategy string = "spread"
+)
+
+// PlaceRequest placement http request data struct, the pods do not need nodes
+type PlaceRequest struct {
+	Pods          []*v1.Pod
+	SchedulerName string
+	NodeSelector  string `json:",omitempty"` // label selector of the candidate nodes
+	Pool          string `json:",omitempty"` // only place the pods in this node pool
+	Strategy      string `json:",omitempty"` // empty means the configured strategy
+}
+
+// PlaceResult placement http return data struct, all pods are placed or none of them
+type PlaceResult struct {
+	Placements map[string]string // key: pod namespace/name, value: the reserved node
+	FailedPods []string
+	Error      string
+	Reason     ErrorReason       `json:",omitempty"` // reason of Error
+	Zones      map[string]string `json:",omitempty"` // key: pod namespace/name, value: the reserved NUMA zone
+	Results    []PodResult       `json:",omitempty"` // the placed pods in the request order
+}
+
+// ValidatePlacementStrategy returns an error if the strategy is unknown, empty means FirstFitStrategy
+func ValidatePlacementStrategy(strategy string) error {
+	switch strategy {
+	case "", FirstFitStrategy, BestFitStrategy, SpreadStrategy:
+		return nil
+	}
+	return fmt.Errorf("unknown placement strategy %q", strategy)
+}
+
+// PlacePods picks nodes for the pods by the strategy and reserves them in one critical section
+func (gr *GloalReserve) PlacePods(request *PlaceRequest) *PlaceResult {
+	strategy := request.Strategy
+	if len(strategy) == 0 {
+		strategy = gr.PlacementStrategy
+	}
+	if err := ValidatePlacementStrategy(strategy); err != nil {
+		return &PlaceResult{Error: err.Error(), Reason: InvalidRequestReason}
+	}
+	selector, err := labels.Parse(request.NodeSelector)
+	if err != nil {
+		return &PlaceResult{Error: err.Error(), Reason: InvalidRequestReason}
+	}
+
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	// nothing in the cache, collect all pods and nodes
+	if gr.NextResourceID == 0 {
+		gr.CollectFromLister()
+	}
+
+	candidates := gr.placementCandidates(selector, request.Pool)
+	// unlike ReservePods, which repairs the totals only after the change, the candidates are repaired
+	// before picking, so a wrong total does not hide a free node from the strategy
+	gr.checkUsage(candidates)
+	rs := gr.newReserveState(time.Now())
+	failed := make([]string, 0, len(request.Pods))
+	podReqs := make([]resVector, len(request.Pods))
+	podNodes := make([]*NodeResInfo, len(request.Pods))
+	podZones := make([]string, len(request.Pods))
+	for i, p := range request.Pods {
+		podReqs[i] = gr.podRequest(p)
+		podNodes[i] = rs.pickNode(p, podReqs[i], candidates, strategy)
+		if podNodes[i] == nil {
+			failed = append(failed, PodKey(p))
+			continue
+		}
+		podZones[i], _ = rs.fit(p, podReqs[i], podNodes[i], true)
+	}
+
+	if len(failed) > 0 {
+		return &PlaceResult{
+			FailedPods: failed,
+			Error:      "No node has enough resource",
+			Reason:     InsufficientResourcesReason,
+		}
+	}
+
+	rs.commit()
+	placements := make(map[string]string)
+	zones := make(map[string]string)
+	results := make([]PodResult, len(request.Pods))
+	for i, p := range request.Pods {
+		gr.addPod(podNodes[i], p, podReqs[i], podZones[i])
+		results[i] = PodResult{Pod: PodKey(p), UID: p.UID, Node: podNodes[i].Name, Zone: podZones[i]}
+		placements[results[i].Pod] = podNodes[i].Name
+		if len(podZones[i]) > 0 {
+			zones[results[i].Pod] = podZones[i]
+		}
+		klog.V(3).Infof("Place pod %s on node %s by %s", PodKey(p), podNodes[i].Name, strategy)
+	}
+	gr.checkUsage(podNodes)
+
+	return &PlaceResult{
+		Placements: placements,
+		FailedPods: failed,
+		Zones:      zones,
+		Results:    results,
+	}
+}
+
+// placementCandidates returns the nodes matching the selector and the pool, ordered by name
+func (gr *GloalReserve) placementCandidates(selector labels.Selector, pool string) []*NodeResInfo {
+	candidates := make([]*NodeResInfo, 0, len(gr.NodeCache))
+	for _, nodeInfo := range gr.NodeCache {
+		if len(pool) > 0 && nodeInfo.Pool != pool {
+			continue
+		}
+		if !selector.Matches(labels.Set(nodeInfo.Labels)) {
+			continue
+		}
+		candidates = append(candidates, nodeInfo)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates
+}
+
+// pickNode returns the fitting node picked by the strategy, nil if no node fits
+func (rs *reserveState) pickNode(pod *v1.Pod, podReq resVector, candidates []*NodeResInfo, strategy string) *NodeResInfo {
+	var picked *NodeResInfo
+	var pickedFree float64
+	for _, nodeInfo := range candidates {
+		if _, fit := rs.fit(pod, podReq, nodeInfo, false); !fit {
+			continue
+		}
+		if strategy == "" || strategy == FirstFitStrategy {
+			return nodeInfo
+		}
+
+		free := rs.freeRatio(nodeInfo, podReq)
+		if picked == nil || (strategy == BestFitStrategy && free < pickedFree) ||
+			(strategy == SpreadStrategy && free > pickedFree) {
+			picked = nodeInfo
+			pickedFree = free
+		}
+	}
+
+	return picked
+}
+
+// freeRatio returns the average ratio of the free resources left on the node after placing the
+// request, only the requested resources are counted
+func (rs *reserveState) freeRatio(nodeInfo *NodeResInfo, podReq resVector) float64 {
+	avai := rs.node(nodeInfo)
+	var sum float64
+	count := 0
+	for i, req := range podReq {
+		if req <= 0 || i >= len(nodeInfo.Capa) || nodeInfo.Capa[i] <= 0 {
+			continue
+		}
+		sum += float64(avai[i]-nodeInfo.Emergency[i]-req) / float64(nodeInfo.Capa[i])
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
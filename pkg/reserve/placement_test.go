@@ -0,0 +1,114 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func initPlacementGR() *GloalReserve {
+	node2 := GetNode2()
+	node2.Labels = map[string]string{"gpu": "true"}
+	pod0 := GetPod("pod0", "1", "100", "node1", v1.PodRunning)
+
+	return InitGR([]*v1.Node{GetNode0(), GetNode1(), node2}, []*v1.Pod{pod0}, true)
+}
+
+func getPlaceRequest(strategy string, cpus ...string) *PlaceRequest {
+	request := &PlaceRequest{SchedulerName: "test", Strategy: strategy}
+	for i, cpu := range cpus {
+		request.Pods = append(request.Pods, GetPod("place"+string('a'+rune(i)), cpu, "100", "", v1.PodPending))
+	}
+	return request
+}
+
+func TestPlacePods(t *testing.T) {
+	t.Run("PlacePods first-fit", func(t *testing.T) {
+		gr := initPlacementGR()
+		ret := gr.PlacePods(getPlaceRequest(FirstFitStrategy, "1"))
+		if len(ret.Error) > 0 || ret.Placements["NS1/placea"] != "node0" {
+			t.Errorf("first-fit failed")
+		}
+	})
+
+	t.Run("PlacePods best-fit", func(t *testing.T) {
+		gr := initPlacementGR()
+		ret := gr.PlacePods(getPlaceRequest(BestFitStrategy, "1"))
+		if len(ret.Error) > 0 || ret.Placements["NS1/placea"] != "node1" {
+			t.Errorf("best-fit failed")
+		}
+	})
+
+	t.Run("PlacePods spread", func(t *testing.T) {
+		gr := initPlacementGR()
+		ret := gr.PlacePods(getPlaceRequest(SpreadStrategy, "1", "1"))
+		if len(ret.Error) > 0 || ret.Placements["NS1/placea"] != "node0" || ret.Placements["NS1/placeb"] != "node2" {
+			t.Errorf("spread failed")
+		}
+	})
+
+	t.Run("PlacePods configured strategy", func(t *testing.T) {
+		gr := initPlacementGR()
+		gr.PlacementStrategy = BestFitStrategy
+		ret := gr.PlacePods(getPlaceRequest("", "1"))
+		if len(ret.Error) > 0 || ret.Placements["NS1/placea"] != "node1" {
+			t.Errorf("configured strategy failed")
+		}
+	})
+
+	t.Run("PlacePods node selector", func(t *testing.T) {
+		gr := initPlacementGR()
+		request := getPlaceRequest("", "1", "1")
+		request.NodeSelector = "gpu=true"
+		ret := gr.PlacePods(request)
+		if len(ret.Error) > 0 || ret.Placements["NS1/placea"] != "node2" || ret.Placements["NS1/placeb"] != "node2" {
+			t.Errorf("node selector failed")
+		}
+	})
+
+	t.Run("PlacePods all or nothing", func(t *testing.T) {
+		gr := initPlacementGR()
+		ret := gr.PlacePods(getPlaceRequest("", "2", "2", "2"))
+		if len(ret.Error) == 0 || ret.Reason != InsufficientResourcesReason || len(ret.FailedPods) != 1 || ret.FailedPods[0] != "NS1/placec" {
+			t.Errorf("all or nothing error failed")
+		}
+		if len(gr.NodeCache["node0"].Pods) != 0 || len(gr.NodeCache["node2"].Pods) != 0 {
+			t.Errorf("all or nothing failed")
+		}
+	})
+
+	t.Run("PlacePods invalid strategy", func(t *testing.T) {
+		gr := initPlacementGR()
+		if ret := gr.PlacePods(getPlaceRequest("worst-fit", "1")); len(ret.Error) == 0 || ret.Reason != InvalidRequestReason {
+			t.Errorf("invalid strategy failed")
+		}
+	})
+
+	t.Run("PlacePods consistency check", func(t *testing.T) {
+		// node0 looks full because of a wrong total, it is repaired before placing
+		gr := initPlacementGR()
+		gr.ConsistencyCheck = true
+		node0 := gr.NodeCache["node0"]
+		node0.Requested[gr.ResTypeToID[v1.ResourceCPU]] = node0.Capa[gr.ResTypeToID[v1.ResourceCPU]]
+		ret := gr.PlacePods(getPlaceRequest(FirstFitStrategy, "1"))
+		if len(ret.Error) > 0 || ret.Placements["NS1/placea"] != "node0" || node0.CheckUsage() != nil {
+			t.Errorf("consistency check failed: %+v", ret)
+		}
+	})
+}
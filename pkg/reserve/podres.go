@@ -17,16 +17,36 @@
 package reserve
 
 import (
+	"time"
+
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog"
 )
 
+// reservation states of the pods in NodeResInfo.Pods
+const (
+	// ReservedState the pod is reserved by a scheduler and not bound yet
+	ReservedState string = "Reserved"
+	// BoundState the pod is bound to the node
+	BoundState string = "Bound"
+)
+
 // PodResInfo save pod infomation in NodeResInfo.Pods
 type PodResInfo struct {
+	Namespace string
 	Name      string
+	UID       types.UID
 	Status    v1.PodPhase
 	Resources resVector
-	Source    string // which scheduler create this pod
+	Source    string    // which scheduler create this pod
+	Zone      string    // the NUMA zone holding this pod, empty if the pod is not zone aligned
+	Booking   string    // the booking consumed by this pod
+	Gang      string    // namespace/name of the gang of this pod, empty if the pod is not in a gang
+	End       time.Time // when the pod is expected to end, zero if it is unknown
+
+	State      string    // ReservedState or BoundState
+	ReservedAt time.Time // when the pod is reserved, zero if the pod is bound without reserving
 }
 
 // NewPodInfo reates a PodResInfo by pod
@@ -34,15 +54,27 @@ func NewPodInfo(pod *v1.Pod, resIDMap map[v1.ResourceName]int, resVecLen int) *P
 	resources := make([]int64, resVecLen)
 	GetPodReq(pod, resIDMap, resources)
 
-	schedulerName := pod.Spec.SchedulerName
-	if len(schedulerName) < 1 {
-		schedulerName = ReserveSchedulerName
+	return newPodInfoWithReq(pod, resources)
+}
+
+// newPodInfoWithReq creates a PodResInfo by pod and its translated requests
+func newPodInfoWithReq(pod *v1.Pod, resources resVector) *PodResInfo {
+	schedulerName := podSchedulerName(pod)
+	gang := ""
+	if name := pod.Labels[GangLabel]; len(name) > 0 {
+		gang = pod.Namespace + "/" + name
 	}
 	return &PodResInfo{
+		Namespace: pod.Namespace,
 		Name:      pod.Name,
+		UID:       pod.UID,
 		Status:    pod.Status.Phase,
 		Resources: resources,
 		Source:    schedulerName,
+		Booking:   pod.Annotations[BookingAnnotation],
+		Gang:      gang,
+		End:       GetPodExpectedEnd(pod, time.Now()),
+		State:     BoundState,
 	}
 }
 
@@ -59,22 +91,32 @@ func addResourceList(list, new v1.ResourceList) {
 
 // GetPodReq translates pod resource requrments into a int64 slice
 func GetPodReq(pod *v1.Pod, resIDMap map[v1.ResourceName]int, resVec []int64 /*return value*/) {
-	reqs := v1.ResourceList{}
+	ResourceListToVector(DefaultPodRequests(pod), resIDMap, resVec)
+}
 
-	for _, container := range pod.Spec.Containers {
-		addResourceList(reqs, container.Resources.Requests)
+// GetPodPriority returns the priority of the pod, 0 if the priority is not set
+func GetPodPriority(pod *v1.Pod) int32 {
+	if pod.Spec.Priority != nil {
+		return *pod.Spec.Priority
 	}
+	return 0
+}
 
-	for resName, resValue := range reqs {
-		resIndex := resIDMap[resName]
-		resVec[resIndex] = QuantityToInt(resName, resValue)
+// ResourceListToVector translates a resource list into an int64 slice, the resources not in resIDMap are ignored
+func ResourceListToVector(list v1.ResourceList, resIDMap map[v1.ResourceName]int, resVec []int64 /*return value*/) {
+	for resName, resValue := range list {
+		if resIndex, ok := resIDMap[resName]; ok {
+			resVec[resIndex] = QuantityToInt(resName, resValue)
+		}
 	}
+}
 
-	resIndex := resIDMap[v1.ResourcePods]
-	resVec[resIndex] = 1
+// Key returns namespace/name of the pod, see PodKey
+func (pr *PodResInfo) Key() string {
+	return pr.Namespace + "/" + pr.Name
 }
 
 // Dump for debugging
 func (pr *PodResInfo) Dump() {
-	klog.Infof("        %s, %s, %s  : %v", pr.Name, pr.Source, pr.Status, pr.Resources)
+	klog.Infof("        %s (%s), %s, %s, %s, %s  : %v", pr.Key(), pr.UID, pr.Source, pr.Status, pr.State, pr.Zone, pr.Resources)
 }
@@ -0,0 +1,62 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"math"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// unlimitedQuota is used for the resources not limited by the quota
+const unlimitedQuota int64 = math.MaxInt64 / 2
+
+// podSchedulerName returns the scheduler name saved as PodResInfo.Source for the pod
+func podSchedulerName(pod *v1.Pod) string {
+	if len(pod.Spec.SchedulerName) < 1 {
+		return ReserveSchedulerName
+	}
+	return pod.Spec.SchedulerName
+}
+
+// quota returns the resources the scheduler can still reserve, nil if the scheduler has no quota
+func (rs *reserveState) quota(schedulerName string) resVector {
+	if avai, ok := rs.quotaAvai[schedulerName]; ok {
+		return avai
+	}
+
+	limits, ok := rs.gr.Quotas[schedulerName]
+	if !ok {
+		rs.quotaAvai[schedulerName] = nil
+		return nil
+	}
+
+	avai := make([]int64, rs.gr.ResTypeMaxKind)
+	for i := range avai {
+		avai[i] = unlimitedQuota
+	}
+	ResourceListToVector(limits, rs.gr.ResTypeToID, avai)
+	// succeeded and failed pods are not counted in SchedulerUsage
+	for _, nodeInfo := range rs.gr.NodeCache {
+		if usage, ok := nodeInfo.SchedulerUsage[schedulerName]; ok {
+			VectorMinus(avai, usage)
+		}
+	}
+
+	rs.quotaAvai[schedulerName] = avai
+	return avai
+}
@@ -0,0 +1,321 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	schedulerlisters "k8s.io/kubernetes/pkg/scheduler/listers"
+	schedulernodeinfo "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+)
+
+// DefaultReconcileInterval is used when GRConf.ReconcileIntervalSeconds is not specified
+const DefaultReconcileInterval = time.Minute
+
+// kinds of the corrections made by Reconciler
+const (
+	MissingNodeCorrection string = "MissingNode" // node listed but not cached, added
+	StaleNodeCorrection   string = "StaleNode"   // node cached but not listed twice in a row, removed
+	MissingPodCorrection  string = "MissingPod"  // bound pod listed but not cached, added
+	StalePodCorrection    string = "StalePod"    // bound pod cached but not listed twice in a row, removed
+	MovedPodCorrection    string = "MovedPod"    // pod cached on another node than it is bound, moved
+	PodStatusCorrection   string = "PodStatus"   // phase, bound state or requests of a cached pod are out of date, updated
+	PodIndexCorrection    string = "PodIndex"    // PodToNode does not match the cached pods, fixed
+	UsageCorrection       string = "Usage"       // requested or reserved totals of a node are wrong, recomputed
+)
+
+// Correction is a drift of the cache repaired by Reconciler
+type Correction struct {
+	Kind string
+	Node string
+	Pod  string    `json:",omitempty"` // namespace/name, empty if the pod is only indexed
+	UID  types.UID `json:",omitempty"`
+}
+
+// ReconcileResult is returned by one run of Reconciler
+type ReconcileResult struct {
+	Time        time.Time
+	Corrections []Correction
+}
+
+// Reconciler compares GloalReserve.NodeCache with the node and pod listers and repairs the missing,
+// stale and mis-placed nodes and pods. It runs every interval and when it is triggered.
+//
+// The nodes and bound pods which are cached but not listed are only removed when they are not listed
+// in two runs in a row, so the informer events on the way are not undone. The pods reserved but not
+// bound yet are left to the reservation TTL.
+type Reconciler struct {
+	gr         *GloalReserve
+	nodeLister schedulerlisters.NodeInfoLister
+	podLister  schedulerlisters.PodLister
+	interval   time.Duration
+	trigger    chan struct{}
+
+	mu         sync.Mutex         // serializes the runs
+	stalePods  map[types.UID]bool // key: pod uid, the bound pods not listed by the last run
+	staleNodes map[string]bool    // key: node name, the nodes not listed by the last run
+}
+
+// NewReconciler returns a Reconciler of gr with the listers, which should be backed by the informers
+// instead of a scheduler snapshot. The interval is only used by Run.
+func NewReconciler(gr *GloalReserve, nodeLister schedulerlisters.NodeInfoLister, podLister schedulerlisters.PodLister,
+	interval time.Duration) *Reconciler {
+	registerMetrics()
+
+	return &Reconciler{
+		gr:         gr,
+		nodeLister: nodeLister,
+		podLister:  podLister,
+		interval:   interval,
+		trigger:    make(chan struct{}, 1),
+		stalePods:  make(map[types.UID]bool),
+		staleNodes: make(map[string]bool),
+	}
+}
+
+// Run reconciles every interval and when Trigger is called until stopCh is closed
+func (r *Reconciler) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		case <-r.trigger:
+		}
+		r.Reconcile()
+	}
+}
+
+// Trigger asks Run to reconcile soon without waiting for the result
+func (r *Reconciler) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Reconcile compares the cache with the listers now and returns the corrections
+func (r *Reconciler) Reconcile() *ReconcileResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	gr := r.gr
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	result := &ReconcileResult{Time: time.Now()}
+	reconcileRuns.Inc()
+
+	// nothing in the cache, collect all pods and nodes
+	if gr.NextResourceID == 0 {
+		if err := gr.CollectFromLister(); err != nil {
+			klog.Errorf("Reconciling GloalReserve failed with: %s", err.Error())
+		}
+		return result
+	}
+
+	// the listers are read with the cache locked, they are never behind the informer events which
+	// are waiting for the lock
+	nodes, err := r.nodeLister.List()
+	if err != nil {
+		klog.Errorf("Reconciling GloalReserve failed, can not list nodes: %s", err.Error())
+		return result
+	}
+	pods, err := r.podLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Reconciling GloalReserve failed, can not list pods: %s", err.Error())
+		return result
+	}
+
+	r.reconcileNodes(result, nodes)
+	r.reconcilePods(result, pods)
+	r.reconcilePodIndex(result)
+	for _, nodeInfo := range gr.NodeCache {
+		if err := nodeInfo.CheckUsage(); err != nil {
+			r.correct(result, Correction{Kind: UsageCorrection, Node: nodeInfo.Name}, err.Error())
+		}
+	}
+
+	klog.V(3).Infof("Reconciled GloalReserve with %d corrections", len(result.Corrections))
+	return result
+}
+
+// correct records the correction in the result, the log and the metrics
+func (r *Reconciler) correct(result *ReconcileResult, c Correction, message string) {
+	klog.Warningf("Reconcile %s: %s", c.Kind, message)
+	reconcileCorrections.WithLabelValues(c.Kind).Inc()
+	result.Corrections = append(result.Corrections, c)
+}
+
+func (r *Reconciler) reconcileNodes(result *ReconcileResult, nodes []*schedulernodeinfo.NodeInfo) {
+	gr := r.gr
+	listed := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		node := n.Node()
+		if node == nil {
+			continue
+		}
+		listed[node.Name] = true
+		delete(r.staleNodes, node.Name)
+		if _, ok := gr.NodeCache[node.Name]; !ok {
+			gr.addResTypes(node)
+			gr.NodeCache[node.Name] = gr.newNodeResInfo(node)
+			r.correct(result, Correction{Kind: MissingNodeCorrection, Node: node.Name}, "node "+node.Name+" is added")
+		}
+	}
+
+	for nodeName, nodeInfo := range gr.NodeCache {
+		if listed[nodeName] {
+			continue
+		}
+		if !r.staleNodes[nodeName] {
+			r.staleNodes[nodeName] = true
+			continue
+		}
+		for uid := range nodeInfo.Pods {
+			delete(gr.PodToNode, uid)
+		}
+		delete(gr.NodeCache, nodeName)
+		delete(r.staleNodes, nodeName)
+		r.correct(result, Correction{Kind: StaleNodeCorrection, Node: nodeName}, "node "+nodeName+" is removed")
+	}
+}
+
+func (r *Reconciler) reconcilePods(result *ReconcileResult, pods []*v1.Pod) {
+	gr := r.gr
+
+	// where the pods are cached, PodToNode may be wrong and is not used
+	cached := make(map[types.UID]*NodeResInfo)
+	for _, nodeInfo := range gr.NodeCache {
+		for uid := range nodeInfo.Pods {
+			cached[uid] = nodeInfo
+		}
+	}
+
+	bound := make(map[types.UID]bool, len(pods))
+	for _, pod := range pods {
+		nodeName := pod.Spec.NodeName
+		if len(nodeName) == 0 {
+			continue
+		}
+		bound[pod.UID] = true
+		delete(r.stalePods, pod.UID)
+
+		nodeInfo, ok := gr.NodeCache[nodeName]
+		if !ok {
+			klog.V(3).Infof("Reconcile: pod %s is bound on node %s which is not listed", PodKey(pod), nodeName)
+			continue
+		}
+		c := Correction{Node: nodeName, Pod: PodKey(pod), UID: pod.UID}
+
+		oldNode, ok := cached[pod.UID]
+		switch {
+		case !ok:
+			gr.addBoundPod(nodeInfo, pod)
+			c.Kind = MissingPodCorrection
+			r.correct(result, c, "pod "+c.Pod+" is added on node "+nodeName)
+		case oldNode != nodeInfo:
+			oldNode.removePod(pod.UID)
+			gr.addBoundPod(nodeInfo, pod)
+			gr.checkUsage([]*NodeResInfo{oldNode, nodeInfo})
+			c.Kind = MovedPodCorrection
+			r.correct(result, c, "pod "+c.Pod+" is moved from node "+oldNode.Name+" to node "+nodeName)
+		default:
+			podInfo := nodeInfo.Pods[pod.UID]
+			if podInfo.Status != pod.Status.Phase || podInfo.State != BoundState ||
+				!VectorEqual(podInfo.Resources, gr.podRequest(pod)) {
+				gr.updateBoundPod(nodeInfo, pod)
+				c.Kind = PodStatusCorrection
+				r.correct(result, c, "pod "+c.Pod+" is "+string(pod.Status.Phase)+" on node "+nodeName)
+			}
+		}
+	}
+
+	for uid, nodeInfo := range cached {
+		podInfo, ok := nodeInfo.Pods[uid]
+		if !ok || bound[uid] || podInfo.State == ReservedState {
+			continue
+		}
+		if !r.stalePods[uid] {
+			r.stalePods[uid] = true
+			continue
+		}
+		nodeInfo.removePod(uid)
+		delete(gr.PodToNode, uid)
+		delete(r.stalePods, uid)
+		c := Correction{Kind: StalePodCorrection, Node: nodeInfo.Name, Pod: podInfo.Key(), UID: uid}
+		r.correct(result, c, "pod "+c.Pod+" is removed from node "+nodeInfo.Name)
+	}
+
+	// forget the pods which are not cached any more
+	for uid := range r.stalePods {
+		if _, ok := cached[uid]; !ok {
+			delete(r.stalePods, uid)
+		}
+	}
+}
+
+func (r *Reconciler) reconcilePodIndex(result *ReconcileResult) {
+	gr := r.gr
+	cached := make(map[types.UID]string)
+	for nodeName, nodeInfo := range gr.NodeCache {
+		for uid, podInfo := range nodeInfo.Pods {
+			cached[uid] = nodeName
+			if indexed, ok := gr.PodToNode[uid]; !ok || indexed != nodeName {
+				gr.PodToNode[uid] = nodeName
+				c := Correction{Kind: PodIndexCorrection, Node: nodeName, Pod: podInfo.Key(), UID: uid}
+				r.correct(result, c, "pod "+c.Pod+" is indexed on node "+nodeName)
+			}
+		}
+	}
+
+	for uid, nodeName := range gr.PodToNode {
+		if _, ok := cached[uid]; !ok {
+			delete(gr.PodToNode, uid)
+			c := Correction{Kind: PodIndexCorrection, Node: nodeName, UID: uid}
+			r.correct(result, c, "pod "+string(uid)+" is not cached on node "+nodeName)
+		}
+	}
+}
+
+// getReconciler returns the Reconciler of gr, one with the listers of gr is created if gr is not
+// created by NewLocalReserve or NewInformerReserve
+func (gr *GloalReserve) getReconciler() *Reconciler {
+	gr.reconcilerOnce.Do(func() {
+		if gr.reconciler == nil {
+			interval := gr.ReconcileInterval
+			if interval <= 0 {
+				interval = DefaultReconcileInterval
+			}
+			gr.reconciler = NewReconciler(gr, gr.NodeLister, gr.PodLister, interval)
+		}
+	})
+	return gr.reconciler
+}
+
+// Reconcile compares the cache with the listers now, repairs the drift and returns the corrections
+func (gr *GloalReserve) Reconcile() *ReconcileResult {
+	return gr.getReconciler().Reconcile()
+}
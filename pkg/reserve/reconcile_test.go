@@ -0,0 +1,182 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// countCorrections returns the number of corrections of the kind
+func countCorrections(result *ReconcileResult, kind string) int {
+	n := 0
+	for _, c := range result.Corrections {
+		if c.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func TestReconcile(t *testing.T) {
+	pod0 := GetPod("pod0", "1", "100", "node0", v1.PodRunning)
+	pod1 := GetPod("pod1", "1", "100", "node0", v1.PodRunning)
+	gr := InitGR([]*v1.Node{GetNode0(), GetNode1()}, []*v1.Pod{pod0, pod1}, true)
+	r := gr.getReconciler()
+	cpu := gr.ResTypeToID[v1.ResourceCPU]
+
+	t.Run("Reconcile nothing to correct", func(t *testing.T) {
+		if result := gr.Reconcile(); len(result.Corrections) != 0 {
+			t.Errorf("nothing to correct failed: %v", result.Corrections)
+		}
+	})
+
+	t.Run("Reconcile missing, moved and finished pods", func(t *testing.T) {
+		// pod2 is bound while the events are dropped, pod0 is moved and pod1 is succeeded
+		r.podLister = StubPodInfoLister([]*v1.Pod{
+			GetPod("pod0", "1", "100", "node1", v1.PodRunning),
+			GetPod("pod1", "1", "100", "node0", v1.PodSucceeded),
+			GetPod("pod2", "500m", "100", "node1", v1.PodRunning),
+		})
+
+		result := gr.Reconcile()
+		if countCorrections(result, MissingPodCorrection) != 1 || countCorrections(result, MovedPodCorrection) != 1 ||
+			countCorrections(result, PodStatusCorrection) != 1 || len(result.Corrections) != 3 {
+			t.Errorf("missing, moved and finished pods failed: %v", result.Corrections)
+		}
+		if gr.PodToNode[pod0.UID] != "node1" || gr.PodToNode["NS1-pod2"] != "node1" ||
+			gr.NodeCache["node0"].Requested[cpu] != 0 || gr.NodeCache["node1"].Requested[cpu] != 1500 {
+			t.Errorf("missing, moved and finished pods failed, the cache is not repaired")
+		}
+		for _, nodeName := range []string{"node0", "node1"} {
+			if err := gr.NodeCache[nodeName].CheckUsage(); err != nil {
+				t.Errorf("missing, moved and finished pods failed, the totals are wrong: %s", err.Error())
+			}
+		}
+	})
+
+	t.Run("Reconcile stale pods", func(t *testing.T) {
+		pod3 := GetPod("pod3", "100m", "100", "node1", v1.PodPending)
+		if ret := gr.Reserve(pod3, "node1"); len(ret) > 0 {
+			t.Fatalf("reserve failed: %s", ret)
+		}
+		// pod2 is deleted while the events are dropped, pod3 is only reserved
+		r.podLister = StubPodInfoLister([]*v1.Pod{
+			GetPod("pod0", "1", "100", "node1", v1.PodRunning),
+			GetPod("pod1", "1", "100", "node0", v1.PodSucceeded),
+		})
+
+		if result := gr.Reconcile(); len(result.Corrections) != 0 {
+			t.Errorf("stale pods failed, pods are removed in the first run: %v", result.Corrections)
+		}
+		result := gr.Reconcile()
+		if countCorrections(result, StalePodCorrection) != 1 || len(result.Corrections) != 1 {
+			t.Errorf("stale pods failed: %v", result.Corrections)
+		}
+		if _, ok := gr.NodeCache["node1"].Pods[pod3.UID]; !ok {
+			t.Errorf("stale pods failed, the reserved pod is removed")
+		}
+	})
+
+	t.Run("Reconcile pod index and usage", func(t *testing.T) {
+		gr.PodToNode["NS1-gone"] = "node0"
+		delete(gr.PodToNode, pod1.UID)
+		gr.NodeCache["node0"].Requested[cpu] = 100
+
+		result := gr.Reconcile()
+		if countCorrections(result, PodIndexCorrection) != 2 || countCorrections(result, UsageCorrection) != 1 {
+			t.Errorf("pod index and usage failed: %v", result.Corrections)
+		}
+		if _, ok := gr.PodToNode["NS1-gone"]; ok || gr.PodToNode[pod1.UID] != "node0" || gr.NodeCache["node0"].Requested[cpu] != 0 {
+			t.Errorf("pod index and usage failed, the cache is not repaired")
+		}
+	})
+
+	t.Run("Reconcile resized pod", func(t *testing.T) {
+		// pod0 is resized while the events are dropped
+		r.podLister = StubPodInfoLister([]*v1.Pod{
+			GetPod("pod0", "500m", "100", "node1", v1.PodRunning),
+			GetPod("pod1", "1", "100", "node0", v1.PodSucceeded),
+		})
+
+		result := gr.Reconcile()
+		if countCorrections(result, PodStatusCorrection) != 1 || len(result.Corrections) != 1 {
+			t.Errorf("resized pod failed: %v", result.Corrections)
+		}
+		if gr.NodeCache["node1"].Requested[cpu] != 500 {
+			t.Errorf("resized pod failed, the cache is not repaired")
+		}
+	})
+
+	t.Run("Reconcile missing and stale nodes", func(t *testing.T) {
+		r.nodeLister = StubNodeInfoLister([]*v1.Node{GetNode0(), GetNode2()})
+
+		result := gr.Reconcile()
+		if countCorrections(result, MissingNodeCorrection) != 1 || len(result.Corrections) != 1 {
+			t.Errorf("missing and stale nodes failed: %v", result.Corrections)
+		}
+		result = gr.Reconcile()
+		if countCorrections(result, StaleNodeCorrection) != 1 || len(gr.NodeCache) != 2 {
+			t.Errorf("missing and stale nodes failed: %v", result.Corrections)
+		}
+		if _, ok := gr.PodToNode[pod0.UID]; ok {
+			t.Errorf("missing and stale nodes failed, the pods of the stale node are indexed")
+		}
+	})
+}
+
+func TestReconcileRoute(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0()}, nil, true)
+	ser, err := InitHTTPServer(gr)
+	if err != nil {
+		t.Fatalf("starting the http server failed with %s", err.Error())
+	}
+	defer ser.Close()
+
+	gr.getReconciler().podLister = StubPodInfoLister([]*v1.Pod{GetPod("pod0", "1", "100", "node0", v1.PodRunning)})
+
+	t.Run("ReconcileRoute on demand", func(t *testing.T) {
+		resp, err := http.Post(ser.URL()+ReconcileHTTPPathPrefix, "application/json", nil)
+		if err != nil {
+			t.Fatalf("on demand failed with %s", err.Error())
+		}
+		defer resp.Body.Close()
+
+		var result ReconcileResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || countCorrections(&result, MissingPodCorrection) != 1 {
+			t.Errorf("on demand failed: %v %v", err, result.Corrections)
+		}
+	})
+
+	t.Run("ReconcileRoute metrics", func(t *testing.T) {
+		resp, err := http.Get(ser.URL() + MetricsHTTPPathPrefix)
+		if err != nil {
+			t.Fatalf("metrics failed with %s", err.Error())
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		if !strings.Contains(string(body), `globalreserve_reconcile_corrections_total{kind="MissingPod"}`) {
+			t.Errorf("metrics failed: %s", body)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"context"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+)
+
+// ReleaseRequest selects the pods to release without sending the pod objects, a pod is released if
+// it matches any of the selectors
+type ReleaseRequest struct {
+	UIDs          []types.UID `json:",omitempty"` // the pods with these UIDs, like Unreserve
+	Gang          string      `json:",omitempty"` // the reserved pods of the gang, namespace/name of GangLabel
+	SchedulerName string      `json:",omitempty"` // the reserved pods of the scheduler, see PodResInfo.Source
+}
+
+// ReleaseResult release http return data struct
+type ReleaseResult struct {
+	Released []PodResult // the pods actually released, the pods not cached are not listed
+	Error    string
+	Reason   ErrorReason `json:",omitempty"`
+}
+
+// selects returns true if the pod is reserved and not bound yet, and its gang or scheduler is
+// selected by the request
+func (r *ReleaseRequest) selects(podInfo *PodResInfo) bool {
+	if podInfo.State != ReservedState {
+		return false
+	}
+	return (len(r.Gang) > 0 && podInfo.Gang == r.Gang) ||
+		(len(r.SchedulerName) > 0 && podInfo.Source == r.SchedulerName)
+}
+
+// ReleaseWithContext releases the pods selected by the request, the nodes are found in the cache.
+// The bound pods are only released by UID, the gang and the scheduler name only select the pods
+// reserved but not bound yet. It returns the released pods, the UIDs in the request order first.
+func (gr *GloalReserve) ReleaseWithContext(ctx context.Context, request *ReleaseRequest) ([]PodResult, error) {
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	if len(request.UIDs) == 0 && len(request.Gang) == 0 && len(request.SchedulerName) == 0 {
+		return nil, newReserveError(InvalidRequestReason, "none of UIDs, gang and scheduler name is specified")
+	}
+
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	released := make([]PodResult, 0, len(request.UIDs))
+	touched := make(map[string]*NodeResInfo)
+	for _, uid := range request.UIDs {
+		nodeName, ok := gr.podNode(uid)
+		if !ok {
+			continue
+		}
+		nodeInfo, ok := gr.NodeCache[nodeName]
+		if !ok {
+			gr.deletePodNodeOn(uid, nodeName)
+			continue
+		}
+		if result, ok := gr.releasePod(nodeInfo, uid); ok {
+			released = append(released, result)
+			touched[nodeName] = nodeInfo
+		}
+	}
+
+	if len(request.Gang) > 0 || len(request.SchedulerName) > 0 {
+		var selected []PodResult
+		for nodeName, nodeInfo := range gr.NodeCache {
+			for uid, podInfo := range nodeInfo.Pods {
+				if !request.selects(podInfo) {
+					continue
+				}
+				result, _ := gr.releasePod(nodeInfo, uid)
+				selected = append(selected, result)
+				touched[nodeName] = nodeInfo
+			}
+		}
+		sort.Slice(selected, func(i, j int) bool {
+			if selected[i].Node != selected[j].Node {
+				return selected[i].Node < selected[j].Node
+			}
+			return selected[i].Pod < selected[j].Pod
+		})
+		released = append(released, selected...)
+	}
+
+	nodes := make([]*NodeResInfo, 0, len(touched))
+	for _, nodeInfo := range touched {
+		nodes = append(nodes, nodeInfo)
+	}
+	gr.checkUsage(nodes)
+
+	return released, nil
+}
+
+// releasePod removes the pod from the locked node and the index, it returns false if the pod is not
+// cached on the node
+func (gr *GloalReserve) releasePod(nodeInfo *NodeResInfo, uid types.UID) (PodResult, bool) {
+	defer gr.deletePodNodeOn(uid, nodeInfo.Name)
+
+	podInfo, ok := nodeInfo.Pods[uid]
+	if !ok {
+		return PodResult{UID: uid}, false
+	}
+	nodeInfo.removePod(uid)
+	klog.V(3).Infof("Release pod %s (%s) on node %s", podInfo.Key(), uid, nodeInfo.Name)
+	return PodResult{Pod: podInfo.Key(), UID: uid, Node: nodeInfo.Name}, true
+}
@@ -0,0 +1,96 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// testRelease runs the same checks against the local and remote implementations, bound is running
+// on node1 and not reserved
+func testRelease(t *testing.T, impl GlobalReserverInterface, bound *v1.Pod) {
+	ctx := context.TODO()
+	batch := GetPod("batch0", "100m", "100", "", v1.PodPending)
+	batch.Spec.SchedulerName = "batch"
+	pods := []*v1.Pod{GetGangPod("gang1", "100m", "", "job", 2), GetGangPod("gang0", "100m", "", "job", 2), batch}
+	if _, err := impl.ReservePodsWithContext(ctx, pods, []string{"node0", "node0", "node1"}); err != nil {
+		t.Fatalf("reserve failed with %v", err)
+	}
+
+	t.Run("Release nothing selected", func(t *testing.T) {
+		if _, err := impl.ReleaseWithContext(ctx, &ReleaseRequest{}); ReasonForError(err) != InvalidRequestReason {
+			t.Errorf("nothing selected failed with %v", err)
+		}
+	})
+
+	t.Run("Release gang", func(t *testing.T) {
+		released, err := impl.ReleaseWithContext(ctx, &ReleaseRequest{Gang: "NS1/job"})
+		if err != nil || len(released) != 2 || released[0].Pod != "NS1/gang0" || released[1].Pod != "NS1/gang1" ||
+			released[0].Node != "node0" || released[0].UID != "NS1-gang0" {
+			t.Errorf("gang failed with %v %+v", err, released)
+		}
+	})
+
+	t.Run("Release scheduler keeps bound pods", func(t *testing.T) {
+		released, err := impl.ReleaseWithContext(ctx, &ReleaseRequest{SchedulerName: "batch"})
+		if err != nil || len(released) != 1 || released[0].Pod != "NS1/batch0" || released[0].Node != "node1" {
+			t.Errorf("scheduler failed with %v %+v", err, released)
+		}
+	})
+
+	t.Run("Release UIDs", func(t *testing.T) {
+		released, err := impl.ReleaseWithContext(ctx, &ReleaseRequest{UIDs: []types.UID{"NS1-gone", bound.UID, batch.UID}})
+		if err != nil || len(released) != 1 || released[0].UID != bound.UID || released[0].Node != "node1" {
+			t.Errorf("UIDs failed with %v %+v", err, released)
+		}
+	})
+}
+
+func TestRelease(t *testing.T) {
+	newGR := func() (*GloalReserve, *v1.Pod) {
+		bound := GetPod("bound0", "100m", "100", "node1", v1.PodRunning)
+		bound.Spec.SchedulerName = "batch"
+		gr := InitGR([]*v1.Node{GetNode0(), GetNode1()}, []*v1.Pod{bound}, true)
+		gr.ConsistencyCheck = true
+		return gr, bound
+	}
+
+	t.Run("local", func(t *testing.T) {
+		gr, bound := newGR()
+		testRelease(t, gr, bound)
+		if len(gr.PodToNode) != 0 || len(gr.NodeCache["node0"].Pods) != 0 || len(gr.NodeCache["node1"].Pods) != 0 ||
+			len(gr.CheckConsistency()) != 0 {
+			t.Errorf("local failed, the cache is not released")
+		}
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		gr, bound := newGR()
+		ser, err := InitHTTPServer(gr)
+		if err != nil {
+			t.Fatalf("starting the http server failed with %s", err.Error())
+		}
+		defer ser.Close()
+
+		ghc, _ := NewHTTPClient(ser.URL(), 5)
+		testRelease(t, ghc, bound)
+	})
+}
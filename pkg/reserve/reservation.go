@@ -0,0 +1,100 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// reservationExpired returns true if the pod is reserved but not bound within the TTL
+func (gr *GloalReserve) reservationExpired(podInfo *PodResInfo, now time.Time) bool {
+	return gr.ReservationTTL > 0 && podInfo.State == ReservedState && !now.Before(podInfo.ReservedAt.Add(gr.ReservationTTL))
+}
+
+// expireReservations releases the reserved pods which are not bound within the TTL
+func (gr *GloalReserve) expireReservations(now time.Time) {
+	if gr.ReservationTTL <= 0 {
+		return
+	}
+
+	for _, nodeInfo := range gr.NodeCache {
+		gr.expireNodeReservations(nodeInfo, now)
+	}
+}
+
+// expireNodeReservations releases the reserved pods on the node which are not bound within the TTL
+func (gr *GloalReserve) expireNodeReservations(nodeInfo *NodeResInfo, now time.Time) {
+	if gr.ReservationTTL <= 0 {
+		return
+	}
+
+	for uid, podInfo := range nodeInfo.Pods {
+		if gr.reservationExpired(podInfo, now) {
+			klog.V(3).Infof("Reservation of pod %s on node %s is expired", podInfo.Key(), nodeInfo.Name)
+			nodeInfo.removePod(uid)
+			gr.deletePodNodeOn(uid, nodeInfo.Name)
+		}
+	}
+}
+
+// VerifyReservation returns an error if the pod is not reserved on the node any more, because the
+// reservation is expired, unreserved or the pod is moved
+func (gr *GloalReserve) VerifyReservation(pod *v1.Pod, nodeName string) error {
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	if reserved, ok := gr.podNode(pod.UID); !ok || reserved != nodeName {
+		return newReserveError(NotReservedReason, "pod %s is not reserved on node %s", PodKey(pod), nodeName)
+	}
+	nodes, ok := gr.lockNodes([]string{nodeName})
+	if !ok {
+		return newReserveError(NodeNotFoundReason, "node %s does not exist", nodeName)
+	}
+	defer gr.unlockNodes(nodes)
+	podInfo, ok := nodes[0].Pods[pod.UID]
+	if !ok {
+		return newReserveError(NotReservedReason, "pod %s is not reserved on node %s", PodKey(pod), nodeName)
+	}
+	if gr.reservationExpired(podInfo, time.Now()) {
+		return newReserveError(ReservationExpiredReason, "reservation of pod %s on node %s is expired", PodKey(pod), nodeName)
+	}
+
+	return nil
+}
+
+// ConfirmBinding marks the pod reserved on the node as bound, so it never expires
+func (gr *GloalReserve) ConfirmBinding(pod *v1.Pod, nodeName string) error {
+	gr.mu.RLock()
+	defer gr.mu.RUnlock()
+
+	nodes, ok := gr.lockNodes([]string{nodeName})
+	if !ok {
+		return newReserveError(NodeNotFoundReason, "node %s does not exist", nodeName)
+	}
+	defer gr.unlockNodes(nodes)
+	podInfo, ok := nodes[0].Pods[pod.UID]
+	if !ok {
+		return newReserveError(NotReservedReason, "pod %s is not reserved on node %s", PodKey(pod), nodeName)
+	}
+
+	klog.V(3).Infof("Pod %s is bound on node %s", PodKey(pod), nodeName)
+	nodes[0].setPodState(podInfo, BoundState)
+	return nil
+}
@@ -0,0 +1,117 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestReservationState(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0()}, nil, true)
+	gr.ReservationTTL = time.Minute
+
+	pod0 := GetPod("pod0", "500m", "100", "node0", v1.PodPending)
+	pod1 := GetPod("pod1", "500m", "100", "node0", v1.PodPending)
+	pod2 := GetPod("pod2", "500m", "100", "node0", v1.PodPending)
+	pods := []*v1.Pod{pod0, pod1, pod2}
+	if ret := gr.ReservePods(pods, []string{"node0", "node0", "node0"}); len(ret.Error) > 0 {
+		t.Fatalf("reserve failed with %s", ret.Error)
+	}
+
+	t.Run("ReservationState verify", func(t *testing.T) {
+		if gr.NodeCache["node0"].Pods[pod0.UID].State != ReservedState || gr.VerifyReservation(pod0, "node0") != nil {
+			t.Errorf("verify failed")
+		}
+		if gr.VerifyReservation(pod0, "node1") == nil {
+			t.Errorf("verify on wrong node failed")
+		}
+	})
+
+	t.Run("ReservationState confirm", func(t *testing.T) {
+		if gr.ConfirmBinding(pod0, "node0") != nil || gr.NodeCache["node0"].Pods[pod0.UID].State != BoundState {
+			t.Errorf("confirm failed")
+		}
+	})
+
+	t.Run("ReservationState bound by informer", func(t *testing.T) {
+		gr.AddPod(pod1)
+		if gr.NodeCache["node0"].Pods[pod1.UID].State != BoundState {
+			t.Errorf("bound by informer failed")
+		}
+	})
+
+	t.Run("ReservationState expired", func(t *testing.T) {
+		for _, podInfo := range gr.NodeCache["node0"].Pods {
+			podInfo.ReservedAt = time.Now().Add(-2 * time.Minute)
+		}
+		if gr.VerifyReservation(pod2, "node0") == nil {
+			t.Errorf("verify expired failed")
+		}
+
+		// the expired reservations are released when reserving
+		if ret := gr.Reserve(GetPod("pod3", "1", "100", "node0", v1.PodPending), "node0"); len(ret) > 0 {
+			t.Errorf("reserve after expired failed")
+		}
+		if _, ok := gr.NodeCache["node0"].Pods[pod2.UID]; ok || len(gr.NodeCache["node0"].Pods) != 3 {
+			t.Errorf("release expired failed")
+		}
+	})
+
+	t.Run("ReservationState unreserved", func(t *testing.T) {
+		gr.Unreserve(pod0, "node0")
+		if gr.VerifyReservation(pod0, "node0") == nil || gr.ConfirmBinding(pod0, "node0") == nil {
+			t.Errorf("unreserved failed")
+		}
+	})
+}
+
+func TestPluginBind(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0()}, nil, true)
+	ser, err := InitHTTPServer(gr)
+	if err != nil {
+		t.Fatalf("starting the http server failed with %s", err.Error())
+	}
+	defer ser.Close()
+
+	ghc, _ := NewHTTPClient(ser.URL(), 5)
+	plugin := &GlobalReservePlugin{ReserveImpl: ghc}
+	pod0 := GetPod("pod0", "500m", "100", "node0", v1.PodPending)
+	pod1 := GetPod("pod1", "500m", "100", "node0", v1.PodPending)
+
+	t.Run("PluginBind prebind", func(t *testing.T) {
+		if status := plugin.Reserve(context.TODO(), nil, pod0, "node0"); !status.IsSuccess() {
+			t.Fatalf("reserve failed")
+		}
+		if !plugin.PreBind(context.TODO(), nil, pod0, "node0").IsSuccess() {
+			t.Errorf("prebind failed")
+		}
+		if plugin.PreBind(context.TODO(), nil, pod1, "node0").IsSuccess() {
+			t.Errorf("prebind without reservation failed")
+		}
+	})
+
+	t.Run("PluginBind postbind", func(t *testing.T) {
+		plugin.PostBind(context.TODO(), nil, pod0, "node0")
+		if gr.NodeCache["node0"].Pods[pod0.UID].State != BoundState {
+			t.Errorf("postbind failed")
+		}
+	})
+}
@@ -17,11 +17,30 @@
 package reserve
 
 import (
+	"context"
+	"time"
+
 	v1 "k8s.io/api/core/v1"
 )
 
-// GlobalReserverInterface interface
+// GlobalReserverInterface is implemented by the local GloalReserve and the remote
+// GloalReserveHTTPClient, the errors are ReserveError in both modes, see ReasonForError
 type GlobalReserverInterface interface {
 	Reserve(pod *v1.Pod, nodeName string) string
 	Unreserve(pod *v1.Pod, nodeName string)
+	ReservePods(pods []*v1.Pod, nodeNames []string) *PodReserveResult
+	UnreservePods(pods []*v1.Pod, nodeNames []string)
+	GetNodeStatus(nodeName string) (*NodeResourceStatus, error)
+	ListNodeStatus() []*NodeResourceStatus
+	FeasibleNodes(pod *v1.Pod) ([]string, error)
+	VerifyReservation(pod *v1.Pod, nodeName string) error
+	ConfirmBinding(pod *v1.Pod, nodeName string) error
+
+	// context aware calls, they return before the work is done if ctx is done
+	ReserveWithContext(ctx context.Context, pod *v1.Pod, nodeName string) error
+	UnreserveWithContext(ctx context.Context, pod *v1.Pod, nodeName string) error
+	ReleaseWithContext(ctx context.Context, request *ReleaseRequest) ([]PodResult, error)
+	ReservePodsWithContext(ctx context.Context, pods []*v1.Pod, nodeNames []string) ([]PodResult, error)
+	ListNodeStatusWithContext(ctx context.Context) ([]*NodeResourceStatus, error)
+	AvailableUntilWithContext(ctx context.Context, nodeName string, until time.Time) (*NodeAvailability, error)
 }
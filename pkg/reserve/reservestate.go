@@ -0,0 +1,252 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// reserveState is a working copy of the free resources used for checking a batch of pods, the
+// resources held by bookings and placeholders are excluded and only released to the pods consuming
+// the bookings or claiming the placeholders. It must be used with GloalReserve.mu write locked, or
+// read locked with only the nodes locked by lockNodes (see nodeLocal).
+type reserveState struct {
+	gr       *GloalReserve
+	now      time.Time
+	bookings []*bookingInfo
+
+	nodeAvai  map[string]resVector            // key: node name, free resources not held by bookings
+	zoneAvai  map[string]map[string]resVector // key: node name, zone name
+	nodeHolds map[string]map[string]resVector // key: node name, booking id, resources still held
+	claims    map[string]map[string]resVector // key: node name, claim token, placeholder resources not claimed
+	poolAvai  map[string]resVector            // key: pool name, free resources not held by bookings
+	poolHolds map[string]map[string]resVector // key: pool name, booking id, resources still held
+	quotaAvai map[string]resVector            // key: scheduler name, resources the scheduler can still reserve
+}
+
+// newReserveState creates a reserveState at the time now, the expired bookings, placeholders and
+// reservations are removed. GloalReserve.mu must be write locked.
+func (gr *GloalReserve) newReserveState(now time.Time) *reserveState {
+	gr.expireBookings(now)
+	gr.expirePlaceholders(now)
+	gr.expireReservations(now)
+	return gr.reserveStateAt(now)
+}
+
+// reserveStateAt creates a reserveState at the time now without removing anything
+func (gr *GloalReserve) reserveStateAt(now time.Time) *reserveState {
+	return &reserveState{
+		gr:        gr,
+		now:       now,
+		bookings:  gr.activeBookings(now),
+		nodeAvai:  make(map[string]resVector),
+		zoneAvai:  make(map[string]map[string]resVector),
+		nodeHolds: make(map[string]map[string]resVector),
+		claims:    make(map[string]map[string]resVector),
+		poolAvai:  make(map[string]resVector),
+		poolHolds: make(map[string]map[string]resVector),
+		quotaAvai: make(map[string]resVector),
+	}
+}
+
+// node returns the free resources of the node including the emergency resources, which are
+// checked by pod priority in fit
+func (rs *reserveState) node(nodeInfo *NodeResInfo) resVector {
+	if avai, ok := rs.nodeAvai[nodeInfo.Name]; ok {
+		return avai
+	}
+
+	avai := nodeInfo.GetAvailable()
+	VectorAdd(avai, nodeInfo.Emergency)
+
+	holds := make(map[string]resVector)
+	for _, b := range rs.bookings {
+		if !b.onNode(nodeInfo.Name) {
+			continue
+		}
+		hold := b.remaining(nodeInfo.bookingUsage(b.ID))
+		VectorMinus(avai, hold)
+		holds[b.ID] = hold
+	}
+
+	claims := make(map[string]resVector)
+	for token, ph := range nodeInfo.Placeholders {
+		claims[token] = make([]int64, len(ph.remaining))
+		copy(claims[token], ph.remaining)
+	}
+
+	rs.nodeAvai[nodeInfo.Name] = avai
+	rs.nodeHolds[nodeInfo.Name] = holds
+	rs.claims[nodeInfo.Name] = claims
+	rs.zoneAvai[nodeInfo.Name] = nodeInfo.GetZoneAvailable()
+	return avai
+}
+
+// pool returns the free resources of the pool, nil if no booking holds resources in the pool
+func (rs *reserveState) pool(poolName string) resVector {
+	if len(poolName) == 0 {
+		return nil
+	}
+	if avai, ok := rs.poolAvai[poolName]; ok {
+		return avai
+	}
+
+	var poolBookings []*bookingInfo
+	for _, b := range rs.bookings {
+		if b.Pool == poolName {
+			poolBookings = append(poolBookings, b)
+		}
+	}
+	if len(poolBookings) == 0 {
+		rs.poolAvai[poolName] = nil
+		return nil
+	}
+
+	avai := make([]int64, rs.gr.ResTypeMaxKind)
+	usage := make(map[string]resVector)
+	for _, nodeInfo := range rs.gr.NodeCache {
+		if nodeInfo.Pool != poolName {
+			continue
+		}
+		VectorAdd(avai, rs.node(nodeInfo))
+		for _, b := range poolBookings {
+			if _, ok := usage[b.ID]; !ok {
+				usage[b.ID] = make([]int64, rs.gr.ResTypeMaxKind)
+			}
+			VectorAdd(usage[b.ID], nodeInfo.bookingUsage(b.ID))
+		}
+	}
+
+	holds := make(map[string]resVector)
+	for _, b := range poolBookings {
+		hold := b.remaining(usage[b.ID])
+		VectorMinus(avai, hold)
+		holds[b.ID] = hold
+	}
+
+	rs.poolAvai[poolName] = avai
+	rs.poolHolds[poolName] = holds
+	return avai
+}
+
+// fit checks the pod can be placed on the node, the resources are taken from rs if assume is true.
+// It returns the picked NUMA zone.
+func (rs *reserveState) fit(pod *v1.Pod, podReq resVector, nodeInfo *NodeResInfo, assume bool) (string, bool) {
+	nodeAvai := rs.node(nodeInfo)
+	poolAvai := rs.pool(nodeInfo.Pool)
+	booking := pod.Annotations[BookingAnnotation]
+	claim := pod.Annotations[ClaimAnnotation]
+
+	// the resources held by the pod's own booking and placeholder are available for it
+	nodeNeed := make([]int64, len(podReq))
+	copy(nodeNeed, podReq)
+	nodeTake := take(rs.nodeHolds[nodeInfo.Name][booking], nodeNeed)
+	VectorMinus(nodeNeed, nodeTake)
+	claimTake := take(rs.claims[nodeInfo.Name][claim], nodeNeed)
+	VectorMinus(nodeNeed, claimTake)
+	poolTake := take(rs.poolHolds[nodeInfo.Pool][booking], nodeNeed)
+
+	check := nodeNeed
+	if !nodeInfo.CanUseEmergency(GetPodPriority(pod)) {
+		check = make([]int64, len(nodeNeed))
+		copy(check, nodeNeed)
+		VectorAdd(check, nodeInfo.Emergency)
+	}
+	if !VectorCompare(nodeAvai, check) {
+		return "", false
+	}
+
+	poolNeed := make([]int64, len(nodeNeed))
+	copy(poolNeed, nodeNeed)
+	VectorMinus(poolNeed, poolTake)
+	if poolAvai != nil && !VectorCompare(poolAvai, poolNeed) {
+		return "", false
+	}
+
+	quotaAvai := rs.quota(podSchedulerName(pod))
+	if quotaAvai != nil && !VectorCompare(quotaAvai, podReq) {
+		return "", false
+	}
+
+	zone := ""
+	if NeedZoneAlignment(pod) {
+		var ok bool
+		if zone, ok = nodeInfo.PickZone(rs.zoneAvai[nodeInfo.Name], podReq); !ok {
+			return "", false
+		}
+	}
+
+	if assume {
+		VectorMinus(nodeAvai, nodeNeed)
+		if hold, ok := rs.nodeHolds[nodeInfo.Name][booking]; ok {
+			VectorMinus(hold, nodeTake)
+		}
+		if hold, ok := rs.claims[nodeInfo.Name][claim]; ok {
+			VectorMinus(hold, claimTake)
+		}
+		if poolAvai != nil {
+			VectorMinus(poolAvai, poolNeed)
+			if hold, ok := rs.poolHolds[nodeInfo.Pool][booking]; ok {
+				VectorMinus(hold, poolTake)
+			}
+		}
+		if len(zone) > 0 {
+			VectorMinus(rs.zoneAvai[nodeInfo.Name][zone], podReq)
+		}
+		if quotaAvai != nil {
+			VectorMinus(quotaAvai, podReq)
+		}
+	}
+
+	return zone, true
+}
+
+// commit saves the placeholders claimed by the assumed pods into the cache
+func (rs *reserveState) commit() {
+	for nodeName, claims := range rs.claims {
+		nodeInfo := rs.gr.NodeCache[nodeName]
+		for token, remaining := range claims {
+			ph, ok := nodeInfo.Placeholders[token]
+			if !ok {
+				continue
+			}
+			if isEmptyVector(remaining) {
+				klog.V(3).Infof("Placeholder %s on node %s is fully claimed", token, nodeName)
+				delete(nodeInfo.Placeholders, token)
+			} else {
+				copy(ph.remaining, remaining)
+			}
+		}
+	}
+}
+
+// take returns the part of req which can be taken from hold
+func take(hold resVector, req resVector) resVector {
+	taken := make([]int64, len(req))
+	for i := range hold {
+		if i < len(req) && hold[i] > 0 {
+			taken[i] = req[i]
+			if hold[i] < req[i] {
+				taken[i] = hold[i]
+			}
+		}
+	}
+	return taken
+}
@@ -21,11 +21,39 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/component-base/metrics/legacyregistry"
 	"k8s.io/klog"
 )
 
+// NewRouter creates the router serving all GloalReserve http requests
+func NewRouter(gr *GloalReserve) *httprouter.Router {
+	router := httprouter.New()
+	router.POST(ReserveHTTPPathPrefix, AddReserveRoute(gr))
+	router.POST(UnreserveHTTPPathPrefix, AddUnreserveRoute(gr))
+	router.POST(ReleaseHTTPPathPrefix, AddReleaseRoute(gr))
+	router.POST(PlaceHTTPPathPrefix, AddPlaceRoute(gr))
+	router.POST(FeasibleHTTPPathPrefix, AddFeasibleRoute(gr))
+	router.POST(VerifyHTTPPathPrefix, AddPodsRoute(gr.VerifyReservation))
+	router.POST(ConfirmHTTPPathPrefix, AddPodsRoute(gr.ConfirmBinding))
+	router.GET(NodesHTTPPathPrefix, AddNodesRoute(gr))
+	router.GET(NodesHTTPPathPrefix+"/:name", AddNodeRoute(gr))
+	router.GET(NodesHTTPPathPrefix+"/:name/available", AddNodeAvailableRoute(gr))
+	router.POST(BookingsHTTPPathPrefix, AddBookingRoute(gr))
+	router.GET(BookingsHTTPPathPrefix, AddListBookingsRoute(gr))
+	router.DELETE(BookingsHTTPPathPrefix+"/:id", AddDeleteBookingRoute(gr))
+	router.POST(PlaceholdersHTTPPathPrefix, AddPlaceholderRoute(gr))
+	router.GET(PlaceholdersHTTPPathPrefix, AddListPlaceholdersRoute(gr))
+	router.DELETE(PlaceholdersHTTPPathPrefix+"/:token", AddDeletePlaceholderRoute(gr))
+	router.POST(ReconcileHTTPPathPrefix, AddReconcileRoute(gr))
+	router.Handler(http.MethodGet, MetricsHTTPPathPrefix, legacyregistry.Handler())
+
+	return router
+}
+
 func checkBody(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
 		http.Error(w, "Please send a request body", 400)
@@ -50,15 +78,21 @@ func AddReserveRoute(gr *GloalReserve) httprouter.Handle {
 			result = &PodReserveResult{
 				FailedPods: nil,
 				Error:      err.Error(),
+				Reason:     InvalidRequestReason,
 			}
 		} else {
 			if len(request.SchedulerName) <= 0 {
 				result = &PodReserveResult{
 					FailedPods: nil,
 					Error:      "Scheduler name is not specified",
+					Reason:     InvalidRequestReason,
 				}
 			} else {
-				result = gr.ReservePods(request.Pods, request.Nodes)
+				setClaims(request.Pods, request.Claims)
+				setSchedulerName(request.Pods, request.SchedulerName)
+				// a client giving up cancels the reservation still waiting for the locks
+				results, err := gr.ReservePodsWithContext(r.Context(), request.Pods, request.Nodes)
+				result = newPodReserveResult(results, err)
 			}
 		}
 
@@ -88,25 +122,309 @@ func AddUnreserveRoute(gr *GloalReserve) httprouter.Handle {
 		klog.V(3).Infof("Receie reserve request %v", body)
 
 		var request PodsReserveRequest
-		var result string
-		status := http.StatusOK
-
 		if err := json.NewDecoder(body).Decode(&request); err != nil {
-			result = err.Error()
-		} else {
-			if len(request.SchedulerName) <= 0 {
-				klog.V(3).Infof("unreserve failed")
-				result = "Scheduler name is not specified"
+			writeJSON(w, http.StatusBadRequest, &PodReserveResult{Error: err.Error(), Reason: InvalidRequestReason})
+			return
+		}
+		if len(request.SchedulerName) <= 0 {
+			klog.V(3).Infof("unreserve failed")
+			writeJSON(w, http.StatusBadRequest, &PodReserveResult{Error: "Scheduler name is not specified", Reason: InvalidRequestReason})
+			return
+		}
+		if len(request.Pods) != len(request.Nodes) {
+			writeJSON(w, http.StatusBadRequest, &PodReserveResult{Error: "The numbers of pods and nodes are different", Reason: InvalidRequestReason})
+			return
+		}
+
+		results := make([]PodResult, len(request.Pods))
+		var firstErr error
+		for i, pod := range request.Pods {
+			results[i] = PodResult{Pod: PodKey(pod), UID: pod.UID, Node: request.Nodes[i]}
+			if err := gr.UnreserveWithContext(r.Context(), pod, request.Nodes[i]); err != nil {
+				results[i].setError(err)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		for _, uid := range request.UIDs {
+			result, err := gr.UnreserveUID(r.Context(), uid)
+			results = append(results, result)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		klog.V(3).Infof("unreserve succeed")
+
+		writeJSON(w, http.StatusOK, newPodReserveResult(results, firstErr))
+	}
+}
+
+// AddReleaseRoute handles releasing the pods selected by UIDs, gang or scheduler name
+func AddReleaseRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		checkBody(w, r)
+
+		var request ReleaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSON(w, http.StatusBadRequest, &ReleaseResult{Error: err.Error(), Reason: InvalidRequestReason})
+			return
+		}
+
+		released, err := gr.ReleaseWithContext(r.Context(), &request)
+		if err != nil {
+			status := http.StatusOK
+			if ReasonForError(err) == InvalidRequestReason {
 				status = http.StatusBadRequest
-			} else {
-				gr.UnreservePods(request.Pods, request.Nodes)
-				klog.V(3).Infof("unreserve succeed")
-				result = ""
 			}
+			writeJSON(w, status, &ReleaseResult{Error: err.Error(), Reason: ReasonForError(err)})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, &ReleaseResult{Released: released})
+	}
+}
+
+// AddPlaceRoute handles placement requests
+func AddPlaceRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		checkBody(w, r)
+
+		var request PlaceRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSON(w, http.StatusBadRequest, &PlaceResult{Error: err.Error(), Reason: InvalidRequestReason})
+			return
+		}
+		if len(request.SchedulerName) <= 0 {
+			writeJSON(w, http.StatusBadRequest, &PlaceResult{Error: "Scheduler name is not specified", Reason: InvalidRequestReason})
+			return
+		}
+
+		setSchedulerName(request.Pods, request.SchedulerName)
+		writeJSON(w, http.StatusOK, gr.PlacePods(&request))
+	}
+}
+
+// AddFeasibleRoute handles querying the nodes which can hold the first pod in the request
+func AddFeasibleRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		checkBody(w, r)
+
+		var request PodsReserveRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSON(w, http.StatusBadRequest, &FeasibleResult{Error: err.Error()})
+			return
+		}
+		if len(request.Pods) == 0 {
+			writeJSON(w, http.StatusBadRequest, &FeasibleResult{Error: "Pod is not specified"})
+			return
+		}
+
+		nodes, err := gr.FeasibleNodes(request.Pods[0])
+		if err != nil {
+			writeJSON(w, http.StatusOK, &FeasibleResult{Error: err.Error()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, &FeasibleResult{Nodes: nodes})
+	}
+}
+
+// AddPodsRoute handles the requests applying action to every pod and its node, the pods failing
+// the action are returned in FailedPods
+func AddPodsRoute(action func(pod *v1.Pod, nodeName string) error) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		checkBody(w, r)
+
+		var request PodsReserveRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSON(w, http.StatusBadRequest, &PodReserveResult{Error: err.Error()})
+			return
+		}
+		if len(request.Pods) != len(request.Nodes) {
+			writeJSON(w, http.StatusBadRequest, &PodReserveResult{Error: "The numbers of pods and nodes are different"})
+			return
+		}
+
+		results := make([]PodResult, len(request.Pods))
+		var lastErr error
+		for i, pod := range request.Pods {
+			results[i] = PodResult{Pod: PodKey(pod), UID: pod.UID, Node: request.Nodes[i]}
+			if err := action(pod, request.Nodes[i]); err != nil {
+				results[i].setError(err)
+				lastErr = err
+			}
+		}
+
+		writeJSON(w, http.StatusOK, newPodReserveResult(results, lastErr))
+	}
+}
+
+// AddReconcileRoute handles reconciling the cache with the informers now
+func AddReconcileRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		writeJSON(w, http.StatusOK, gr.Reconcile())
+	}
+}
+
+// AddNodesRoute handles querying all nodes
+func AddNodesRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		writeJSON(w, http.StatusOK, gr.ListNodeStatus())
+	}
+}
+
+// AddNodeRoute handles querying one node
+func AddNodeRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		status, err := gr.GetNodeStatus(ps.ByName("name"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, status)
+	}
+}
+
+// AddNodeAvailableRoute handles querying the resources free on one node until the time in the
+// until parameter, in RFC3339 format
+func AddNodeAvailableRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		until, err := time.Parse(time.RFC3339, r.URL.Query().Get("until"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := gr.AvailableUntil(ps.ByName("name"), until)
+		if err != nil {
+			status := http.StatusBadRequest
+			if ReasonForError(err) == NodeNotFoundReason {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// AddBookingRoute handles creating bookings
+func AddBookingRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		checkBody(w, r)
+
+		var booking Booking
+		if err := json.NewDecoder(r.Body).Decode(&booking); err != nil {
+			writeJSON(w, http.StatusBadRequest, &BookingResult{Error: err.Error(), Reason: InvalidRequestReason})
+			return
+		}
+
+		if err := gr.AddBooking(&booking); err != nil {
+			writeJSON(w, http.StatusOK, &BookingResult{Error: err.Error(), Reason: ReasonForError(err)})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, &BookingResult{})
+	}
+}
+
+// AddListBookingsRoute handles querying all bookings
+func AddListBookingsRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		writeJSON(w, http.StatusOK, gr.ListBookings())
+	}
+}
+
+// AddDeleteBookingRoute handles deleting bookings
+func AddDeleteBookingRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		id := ps.ByName("id")
+		if !gr.DeleteBooking(id) {
+			writeJSON(w, http.StatusNotFound, &BookingResult{Error: "booking " + id + " does not exist"})
+			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(status)
-		w.Write([]byte(result))
+		writeJSON(w, http.StatusOK, &BookingResult{})
 	}
 }
+
+// setClaims sets the claim tokens in the request on the pods
+func setClaims(pods []*v1.Pod, claims []string) {
+	for i, claim := range claims {
+		if i >= len(pods) || len(claim) == 0 {
+			continue
+		}
+		if pods[i].Annotations == nil {
+			pods[i].Annotations = make(map[string]string)
+		}
+		pods[i].Annotations[ClaimAnnotation] = claim
+	}
+}
+
+// setSchedulerName sets the scheduler name in the request on the pods without one or with the one
+// defaulted by the api server, so the pods are counted in the quota and released with the scheduler of
+// the caller. A pod naming another scheduler keeps it.
+func setSchedulerName(pods []*v1.Pod, schedulerName string) {
+	for _, pod := range pods {
+		if pod != nil && (len(pod.Spec.SchedulerName) == 0 || pod.Spec.SchedulerName == v1.DefaultSchedulerName) {
+			pod.Spec.SchedulerName = schedulerName
+		}
+	}
+}
+
+// AddPlaceholderRoute handles creating placeholders
+func AddPlaceholderRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		checkBody(w, r)
+
+		var placeholder Placeholder
+		if err := json.NewDecoder(r.Body).Decode(&placeholder); err != nil {
+			writeJSON(w, http.StatusBadRequest, &PlaceholderResult{Error: err.Error(), Reason: InvalidRequestReason})
+			return
+		}
+
+		expires, err := gr.AddPlaceholder(&placeholder)
+		if err != nil {
+			writeJSON(w, http.StatusOK, &PlaceholderResult{Error: err.Error(), Reason: ReasonForError(err)})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, &PlaceholderResult{Expires: expires})
+	}
+}
+
+// AddListPlaceholdersRoute handles querying all placeholders
+func AddListPlaceholdersRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		writeJSON(w, http.StatusOK, gr.ListPlaceholders())
+	}
+}
+
+// AddDeletePlaceholderRoute handles deleting placeholders
+func AddDeletePlaceholderRoute(gr *GloalReserve) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		token := ps.ByName("token")
+		if !gr.DeletePlaceholder(token) {
+			writeJSON(w, http.StatusNotFound, &PlaceholderResult{Error: "placeholder " + token + " does not exist"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, &PlaceholderResult{})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, result interface{}) {
+	resultBody, err := json.Marshal(result)
+	if err != nil {
+		klog.Errorf("Failed to marshal result: %+v, %+v", err, result)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resultBody)
+}
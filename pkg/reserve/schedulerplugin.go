@@ -18,29 +18,39 @@ package reserve
 
 import (
 	"context"
-	"strconv"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/klog"
 	framework "k8s.io/kubernetes/pkg/scheduler/framework/v1alpha1"
+	schedulernodeinfo "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
 )
 
 // GlobalReservePlugin is an centralized resources approver by hooking for reserve.
 type GlobalReservePlugin struct {
-	ReserveImpl GlobalReserverInterface
-}
+	ReserveImpl    GlobalReserverInterface
+	Scoring        ScoringConf
+	GangScheduling bool          // reserve the pods of a gang together at permit
+	GangTimeout    time.Duration // how long the gang pods wait at permit for the other members
+
+	// the same pod requests as GloalReserve, so scoring charges what reserving charges
+	PodRequests PodRequestExtractor // nil means DefaultPodRequests
+	Extractors  []ResourceExtractor
 
-// GRConf scheduler plugin configuration
-type GRConf struct {
-	// if globalreserve works in another pod, this field must be specified
-	RemoteURL string `json:"remoteURL,omitempty"`
-	//globalreserve http server listening port
-	Port int `json:"port,omitempty"`
+	handle waitingPodGetter
+	gangs  *gangTracker
 }
 
 var _ framework.ReservePlugin = &GlobalReservePlugin{}
 var _ framework.UnreservePlugin = &GlobalReservePlugin{}
+var _ framework.PreFilterPlugin = &GlobalReservePlugin{}
+var _ framework.FilterPlugin = &GlobalReservePlugin{}
+var _ framework.PostFilterPlugin = &GlobalReservePlugin{}
+var _ framework.PermitPlugin = &GlobalReservePlugin{}
+var _ framework.PreBindPlugin = &GlobalReservePlugin{}
+var _ framework.PostBindPlugin = &GlobalReservePlugin{}
+var _ framework.ScorePlugin = &GlobalReservePlugin{}
 
 // Name is the name of the plugin used in Registry and configurations.
 const Name = "global-resource-reserve-plugin"
@@ -52,11 +62,15 @@ func (rp *GlobalReservePlugin) Name() string {
 
 // Reserve is the functions invoked by the framework at "reserve" extension point.
 func (rp *GlobalReservePlugin) Reserve(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) *framework.Status {
-	klog.V(3).Infof("Reserve Pod %s on node %s", pod.Name, nodeName)
+	klog.V(3).Infof("Reserve Pod %s on node %s", PodKey(pod), nodeName)
 
-	reserveResult := rp.ReserveImpl.Reserve(pod, nodeName)
-	if len(reserveResult) > 0 {
-		return framework.NewStatus(framework.Error, reserveResult)
+	if gang, _ := GetPodGang(pod); rp.GangScheduling && len(gang) > 0 {
+		klog.V(3).Infof("Pod %s of gang %s is reserved at permit", PodKey(pod), gang)
+		return framework.NewStatus(framework.Success, "")
+	}
+
+	if err := rp.ReserveImpl.ReserveWithContext(ctx, pod, nodeName); err != nil {
+		return framework.NewStatus(framework.Error, err.Error())
 	}
 
 	return framework.NewStatus(framework.Success, "")
@@ -64,9 +78,182 @@ func (rp *GlobalReservePlugin) Reserve(ctx context.Context, state *framework.Cyc
 
 // Unreserve is the functions invoked by the framework at "unreserve" extension point.
 func (rp *GlobalReservePlugin) Unreserve(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) {
-	klog.V(3).Infof("Unreserve Pod %s on node %s", pod.Name, nodeName)
+	klog.V(3).Infof("Unreserve Pod %s on node %s", PodKey(pod), nodeName)
+
+	if gang, _ := GetPodGang(pod); rp.GangScheduling && len(gang) > 0 {
+		// the gang is not complete, reject all members together
+		for _, member := range rp.gangs.remove(gang, pod.UID) {
+			if wp := rp.handle.GetWaitingPod(member.pod.UID); wp != nil {
+				wp.Reject("member " + PodKey(pod) + " of gang " + gang + " is rejected")
+			}
+		}
+	}
+
+	if err := rp.ReserveImpl.UnreserveWithContext(ctx, pod, nodeName); err != nil {
+		klog.Warningf("Unreserve pod %s on node %s failed with: %s", PodKey(pod), nodeName, err.Error())
+	}
+}
+
+// feasibleStateKey is the key of the feasible nodes saved in CycleState by PreFilter
+const feasibleStateKey framework.StateKey = Name + "/feasible"
+
+// feasibleState saves the nodes which can hold the pod in CycleState
+type feasibleState map[string]bool
+
+// Clone the feasible nodes are not changed after PreFilter
+func (s feasibleState) Clone() framework.StateData {
+	return s
+}
+
+// PreFilter is the functions invoked by the framework at "prefilter" extension point, it queries the
+// nodes which can hold the pod in the global reserve once for filtering all nodes.
+func (rp *GlobalReservePlugin) PreFilter(ctx context.Context, state *framework.CycleState, pod *v1.Pod) *framework.Status {
+	nodes, err := rp.ReserveImpl.FeasibleNodes(pod)
+	if err != nil {
+		// do not block scheduling, Reserve still checks the resources
+		klog.Warningf("Querying feasible nodes for pod %s failed with: %s", PodKey(pod), err.Error())
+		return framework.NewStatus(framework.Success, "")
+	}
+
+	feasible := make(feasibleState)
+	for _, nodeName := range nodes {
+		feasible[nodeName] = true
+	}
+	state.Write(feasibleStateKey, feasible)
+
+	return framework.NewStatus(framework.Success, "")
+}
+
+// PreFilterExtensions the feasible nodes are not updated for preemption
+func (rp *GlobalReservePlugin) PreFilterExtensions() framework.PreFilterExtensions {
+	return nil
+}
+
+// Filter is the functions invoked by the framework at "filter" extension point, it rejects the nodes
+// which are already promised to other schedulers.
+func (rp *GlobalReservePlugin) Filter(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeInfo *schedulernodeinfo.NodeInfo) *framework.Status {
+	data, err := state.Read(feasibleStateKey)
+	if err != nil {
+		// PreFilter is not enabled or failed
+		return framework.NewStatus(framework.Success, "")
+	}
+
+	if node := nodeInfo.Node(); node == nil || !data.(feasibleState)[node.Name] {
+		return framework.NewStatus(framework.Unschedulable, "Global reserve resource is not enough")
+	}
+
+	return framework.NewStatus(framework.Success, "")
+}
+
+// Permit is the functions invoked by the framework at "permit" extension point, the gang pods wait until
+// all members arrive, and then all members are reserved together or rejected together.
+func (rp *GlobalReservePlugin) Permit(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) (*framework.Status, time.Duration) {
+	gang, size := GetPodGang(pod)
+	if !rp.GangScheduling || len(gang) == 0 {
+		return framework.NewStatus(framework.Success, ""), 0
+	}
+
+	members := rp.gangs.add(gang, size, pod, nodeName)
+	if members == nil {
+		klog.V(3).Infof("Pod %s waits for the other members of gang %s", PodKey(pod), gang)
+		return framework.NewStatus(framework.Wait, ""), rp.GangTimeout
+	}
+
+	pods := make([]*v1.Pod, 0, len(members))
+	nodeNames := make([]string, 0, len(members))
+	for _, member := range members {
+		pods = append(pods, member.pod)
+		nodeNames = append(nodeNames, member.nodeName)
+	}
+
+	result := rp.ReserveImpl.ReservePods(pods, nodeNames)
+	for _, member := range members {
+		if member.pod.UID == pod.UID {
+			continue
+		}
+		wp := getWaitingPod(rp.handle, member.pod.UID)
+		if wp == nil {
+			klog.Warningf("Pod %s of gang %s is not waiting at permit", PodKey(member.pod), gang)
+			continue
+		}
+		if len(result.Error) > 0 {
+			wp.Reject(result.Error)
+		} else {
+			wp.Allow(Name)
+		}
+	}
+
+	if len(result.Error) > 0 {
+		klog.V(3).Infof("Reserving gang %s failed with: %s", gang, result.Error)
+		return framework.NewStatus(framework.Unschedulable, result.Error), 0
+	}
+
+	klog.V(3).Infof("Gang %s is reserved", gang)
+	return framework.NewStatus(framework.Success, ""), 0
+}
+
+// PreBind is the functions invoked by the framework at "prebind" extension point, it verifies the
+// reservation is not expired or preempted before binding.
+func (rp *GlobalReservePlugin) PreBind(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) *framework.Status {
+	if err := rp.ReserveImpl.VerifyReservation(pod, nodeName); err != nil {
+		klog.V(3).Infof("Verifying pod %s on node %s failed with: %s", PodKey(pod), nodeName, err.Error())
+		return framework.NewStatus(framework.Error, err.Error())
+	}
+
+	return framework.NewStatus(framework.Success, "")
+}
+
+// PostBind is the functions invoked by the framework at "postbind" extension point, it marks the
+// reservation as bound without waiting for the informer.
+func (rp *GlobalReservePlugin) PostBind(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) {
+	if err := rp.ReserveImpl.ConfirmBinding(pod, nodeName); err != nil {
+		klog.Warningf("Confirming pod %s on node %s failed with: %s", PodKey(pod), nodeName, err.Error())
+	}
+}
+
+// nodeStatusStateKey is the key of the node status saved in CycleState by PostFilter
+const nodeStatusStateKey framework.StateKey = Name + "/nodeStatus"
 
-	rp.ReserveImpl.Unreserve(pod, nodeName)
+// nodeStatusState saves the node status in CycleState, key: node name
+type nodeStatusState map[string]*NodeResourceStatus
+
+// Clone the node status is not changed after PostFilter
+func (s nodeStatusState) Clone() framework.StateData {
+	return s
+}
+
+// PostFilter is the functions invoked by the framework at "postfilter" extension point, it lists the
+// global node status once for scoring all nodes.
+func (rp *GlobalReservePlugin) PostFilter(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodes []*v1.Node, filteredNodesStatuses framework.NodeToStatusMap) *framework.Status {
+	statuses := make(nodeStatusState)
+	for _, status := range rp.ReserveImpl.ListNodeStatus() {
+		statuses[status.Name] = status
+	}
+	state.Write(nodeStatusStateKey, statuses)
+
+	return framework.NewStatus(framework.Success, "")
+}
+
+// Score is the functions invoked by the framework at "score" extension point.
+func (rp *GlobalReservePlugin) Score(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) (int64, *framework.Status) {
+	var status *NodeResourceStatus
+	if data, err := state.Read(nodeStatusStateKey); err == nil {
+		status = data.(nodeStatusState)[nodeName]
+	} else {
+		// PostFilter is not enabled, query the node directly
+		status, _ = rp.ReserveImpl.GetNodeStatus(nodeName)
+	}
+	if status == nil {
+		klog.V(3).Infof("Node %s is not found in global reserve, score %d", nodeName, framework.MinNodeScore)
+		return framework.MinNodeScore, framework.NewStatus(framework.Success, "")
+	}
+
+	return ScoreNode(status, ExtractPodRequests(pod, rp.PodRequests, rp.Extractors), &rp.Scoring), framework.NewStatus(framework.Success, "")
+}
+
+// ScoreExtensions the scores are already in the range of framework.MaxNodeScore
+func (rp *GlobalReservePlugin) ScoreExtensions() framework.ScoreExtensions {
+	return nil
 }
 
 // New initializes a new plugin and returns it.
@@ -79,25 +266,32 @@ func New(config *runtime.Unknown, handler framework.FrameworkHandle) (framework.
 		return nil, err
 	}
 
+	conf.SetDefaults()
+	if err := conf.Validate(); err != nil {
+		klog.Errorf("Validating configuration failed with: %s", err.Error())
+		return nil, err
+	}
+
+	podRequests, err := GetPodRequestExtractor(conf.PodRequestExtractor)
+	if err != nil {
+		return nil, err
+	}
+	var extractors []ResourceExtractor
+	if len(conf.SharedResources) > 0 {
+		extractors = append(extractors, NewAnnotationExtractor(conf.SharedResources))
+	}
+
 	var impl GlobalReserverInterface
-	var err error
 
-	if len(conf.RemoteURL) > 0 {
-		remote := conf.RemoteURL
-		klog.Infof("Remote Global Reserve URL is %s", remote)
+	if len(conf.remoteURLs()) > 0 {
+		klog.Infof("Remote Global Reserve URLs are %v", conf.remoteURLs())
 
-		if impl, err = NewHTTPClient(remote, 5); err != nil {
+		if impl, err = NewHTTPClientFromConf(conf); err != nil {
 			klog.Errorf("Creating Http client failed with: %s", err.Error())
 			return nil, err
 		}
 	} else {
-		port := "23456"
-
-		if conf.Port > 1024 && conf.Port < 65535 {
-			port = strconv.Itoa(conf.Port)
-		}
-
-		impl, err = NewLocalReserve(handler, port)
+		impl, err = NewLocalReserve(handler, conf)
 		if err != nil {
 			klog.Errorf("Creating GlobalReserve failed with: %s", err.Error())
 			return nil, err
@@ -105,6 +299,13 @@ func New(config *runtime.Unknown, handler framework.FrameworkHandle) (framework.
 	}
 
 	return &GlobalReservePlugin{
-		ReserveImpl: impl,
+		ReserveImpl:    impl,
+		Scoring:        conf.Scoring,
+		GangScheduling: conf.GangScheduling,
+		GangTimeout:    time.Duration(conf.GangTimeoutSeconds) * time.Second,
+		PodRequests:    podRequests,
+		Extractors:     extractors,
+		handle:         handler,
+		gangs:          newGangTracker(),
 	}, nil
 }
@@ -0,0 +1,86 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	framework "k8s.io/kubernetes/pkg/scheduler/framework/v1alpha1"
+	schedulernodeinfo "k8s.io/kubernetes/pkg/scheduler/nodeinfo"
+)
+
+func filterNodes(plugin *GlobalReservePlugin, pod *v1.Pod, nodes ...*v1.Node) []string {
+	state := framework.NewCycleState()
+	plugin.PreFilter(context.TODO(), state, pod)
+
+	var passed []string
+	for _, node := range nodes {
+		nodeInfo := schedulernodeinfo.NewNodeInfo()
+		nodeInfo.SetNode(node)
+		if plugin.Filter(context.TODO(), state, pod, nodeInfo).IsSuccess() {
+			passed = append(passed, node.Name)
+		}
+	}
+	return passed
+}
+
+func TestPluginFilter(t *testing.T) {
+	node0 := GetNode0()
+	node1 := GetNode1()
+	node9 := GetNode0()
+	node9.Name = "node9"
+	gr := InitGR([]*v1.Node{node0, node1}, nil, true)
+	pod := GetPod("pod1", "1500m", "1000", "", v1.PodPending)
+
+	// node0 is already promised to another scheduler
+	if ret := gr.Reserve(GetPod("pod0", "1", "1000", "node0", v1.PodPending), "node0"); len(ret) > 0 {
+		t.Fatalf("reserve failed with %s", ret)
+	}
+
+	t.Run("PluginFilter local", func(t *testing.T) {
+		plugin := &GlobalReservePlugin{ReserveImpl: gr}
+		passed := filterNodes(plugin, pod, node0, node1, node9)
+		if len(passed) != 1 || passed[0] != "node1" {
+			t.Errorf("local failed with %v", passed)
+		}
+	})
+
+	t.Run("PluginFilter remote", func(t *testing.T) {
+		ser, err := InitHTTPServer(gr)
+		if err != nil {
+			t.Fatalf("starting the http server failed with %s", err.Error())
+		}
+		defer ser.Close()
+
+		ghc, _ := NewHTTPClient(ser.URL(), 5)
+		plugin := &GlobalReservePlugin{ReserveImpl: ghc}
+		passed := filterNodes(plugin, pod, node0, node1, node9)
+		if len(passed) != 1 || passed[0] != "node1" {
+			t.Errorf("remote failed with %v", passed)
+		}
+	})
+
+	t.Run("PluginFilter remote unavailable", func(t *testing.T) {
+		ghc, _ := NewHTTPClient("http://127.0.0.1:1", 5)
+		plugin := &GlobalReservePlugin{ReserveImpl: ghc}
+		if passed := filterNodes(plugin, pod, node0, node1); len(passed) != 2 {
+			t.Errorf("remote unavailable failed with %v", passed)
+		}
+	})
+}
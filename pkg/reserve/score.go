@@ -0,0 +1,104 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	framework "k8s.io/kubernetes/pkg/scheduler/framework/v1alpha1"
+)
+
+// scoring strategies of the plugin
+const (
+	// LeastAllocatedStrategy prefers the nodes with the most free resources, spreading the pods
+	LeastAllocatedStrategy string = "least-allocated"
+	// MostAllocatedStrategy prefers the nodes with the least free resources, packing the pods
+	MostAllocatedStrategy string = "most-allocated"
+)
+
+// ScoringConf configures the Score extension point of GlobalReservePlugin
+type ScoringConf struct {
+	//least-allocated or most-allocated, empty means least-allocated
+	Strategy string `json:"strategy,omitempty"`
+	//weights of the resources, empty means cpu and memory weighted 1
+	Weights map[v1.ResourceName]int64 `json:"weights,omitempty"`
+}
+
+// defaultScoringWeights is used when ScoringConf.Weights is empty
+var defaultScoringWeights = map[v1.ResourceName]int64{
+	v1.ResourceCPU:    1,
+	v1.ResourceMemory: 1,
+}
+
+// Validate checks the strategy and the weights
+func (sc *ScoringConf) Validate() error {
+	switch sc.Strategy {
+	case "", LeastAllocatedStrategy, MostAllocatedStrategy:
+	default:
+		return fmt.Errorf("unknown scoring strategy %q", sc.Strategy)
+	}
+	for resName, weight := range sc.Weights {
+		if weight < 0 {
+			return fmt.Errorf("scoring weight of %s is negative", resName)
+		}
+	}
+	return nil
+}
+
+// ScoreNode scores the node by the allocated ratio after placing the pod, using the global
+// effective capacity and the requests of the bound and the reserved pods. The headroom and the
+// emergency resources are not counted as allocated.
+func ScoreNode(status *NodeResourceStatus, podReq v1.ResourceList, conf *ScoringConf) int64 {
+	weights := conf.Weights
+	if len(weights) == 0 {
+		weights = defaultScoringWeights
+	}
+
+	var score, weightSum int64
+	for resName, weight := range weights {
+		capaQuantity, ok := status.EffectiveCapacity[resName]
+		if !ok || weight == 0 {
+			continue
+		}
+		capa := QuantityToInt(resName, capaQuantity)
+		if capa <= 0 {
+			continue
+		}
+
+		allocated := QuantityToInt(resName, status.Requested[resName]) +
+			QuantityToInt(resName, status.Reserved[resName]) + QuantityToInt(resName, podReq[resName])
+		if allocated > capa {
+			allocated = capa
+		}
+		if allocated < 0 {
+			allocated = 0
+		}
+
+		resScore := allocated * framework.MaxNodeScore / capa
+		if conf.Strategy != MostAllocatedStrategy {
+			resScore = framework.MaxNodeScore - resScore
+		}
+		score += resScore * weight
+		weightSum += weight
+	}
+
+	if weightSum == 0 {
+		return framework.MinNodeScore
+	}
+	return score / weightSum
+}
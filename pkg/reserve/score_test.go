@@ -0,0 +1,121 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	framework "k8s.io/kubernetes/pkg/scheduler/framework/v1alpha1"
+)
+
+func TestScoreNode(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0()}, []*v1.Pod{GetPod("pod0", "1", "1000", "node0", v1.PodRunning)}, true)
+	status, _ := gr.GetNodeStatus("node0")
+	podReq := DefaultPodRequests(GetPod("pod1", "500m", "1500", "", v1.PodPending))
+
+	t.Run("ScoreNode least-allocated", func(t *testing.T) {
+		// cpu 75% and memory 50% allocated
+		if score := ScoreNode(status, podReq, &ScoringConf{}); score != 37 {
+			t.Errorf("least-allocated failed with %d", score)
+		}
+	})
+
+	t.Run("ScoreNode most-allocated", func(t *testing.T) {
+		if score := ScoreNode(status, podReq, &ScoringConf{Strategy: MostAllocatedStrategy}); score != 62 {
+			t.Errorf("most-allocated failed with %d", score)
+		}
+	})
+
+	t.Run("ScoreNode weights", func(t *testing.T) {
+		conf := &ScoringConf{
+			Strategy: MostAllocatedStrategy,
+			Weights:  map[v1.ResourceName]int64{v1.ResourceCPU: 3, v1.ResourceMemory: 1},
+		}
+		if score := ScoreNode(status, podReq, conf); score != 68 {
+			t.Errorf("weights failed with %d", score)
+		}
+	})
+
+	t.Run("ScoreNode headroom is not allocated", func(t *testing.T) {
+		empty := &NodeResourceStatus{
+			EffectiveCapacity: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+			Available:         v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+			Headroom:          v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+		}
+		conf := &ScoringConf{Weights: map[v1.ResourceName]int64{v1.ResourceCPU: 1}}
+		if score := ScoreNode(empty, v1.ResourceList{}, conf); score != framework.MaxNodeScore {
+			t.Errorf("headroom is not allocated failed with %d", score)
+		}
+	})
+
+	t.Run("ScoreNode invalid conf", func(t *testing.T) {
+		if (&ScoringConf{Strategy: "balanced"}).Validate() == nil ||
+			(&ScoringConf{Weights: map[v1.ResourceName]int64{v1.ResourceCPU: -1}}).Validate() == nil {
+			t.Errorf("invalid conf failed")
+		}
+	})
+}
+
+func TestPluginScore(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0(), GetNode1()}, nil, true)
+	plugin := &GlobalReservePlugin{ReserveImpl: gr, Scoring: ScoringConf{Strategy: LeastAllocatedStrategy}}
+	pod := GetPod("pod1", "1", "1000", "", v1.PodPending)
+
+	// pods reserved by other schedulers make node0 less preferred
+	if ret := gr.Reserve(GetPod("pod0", "1", "1000", "node0", v1.PodPending), "node0"); len(ret) > 0 {
+		t.Fatalf("reserve failed with %s", ret)
+	}
+
+	t.Run("PluginScore without PostFilter", func(t *testing.T) {
+		state := framework.NewCycleState()
+		score0, _ := plugin.Score(context.TODO(), state, pod, "node0")
+		score1, _ := plugin.Score(context.TODO(), state, pod, "node1")
+		if score0 >= score1 {
+			t.Errorf("without PostFilter failed")
+		}
+	})
+
+	t.Run("PluginScore configured extractor", func(t *testing.T) {
+		limited := GetPod("pod2", "100m", "1000", "", v1.PodPending)
+		limited.Spec.Containers[0].Resources.Limits = v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}
+		extractor, _ := GetPodRequestExtractor("limits")
+		limits := &GlobalReservePlugin{
+			ReserveImpl: gr,
+			Scoring:     ScoringConf{Weights: map[v1.ResourceName]int64{v1.ResourceCPU: 1}},
+			PodRequests: extractor,
+		}
+		if score, _ := limits.Score(context.TODO(), framework.NewCycleState(), limited, "node1"); score != framework.MinNodeScore {
+			t.Errorf("configured extractor failed with %d", score)
+		}
+	})
+
+	t.Run("PluginScore with PostFilter", func(t *testing.T) {
+		state := framework.NewCycleState()
+		if status := plugin.PostFilter(context.TODO(), state, pod, nil, nil); !status.IsSuccess() {
+			t.Fatalf("PostFilter failed")
+		}
+		score0, _ := plugin.Score(context.TODO(), state, pod, "node0")
+		score1, _ := plugin.Score(context.TODO(), state, pod, "node1")
+		score9, _ := plugin.Score(context.TODO(), state, pod, "node9")
+		if score0 >= score1 || score9 != framework.MinNodeScore {
+			t.Errorf("with PostFilter failed")
+		}
+	})
+}
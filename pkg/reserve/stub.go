@@ -18,9 +18,7 @@ package reserve
 
 import (
 	"fmt"
-	"net/http"
 
-	"github.com/julienschmidt/httprouter"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -117,19 +115,9 @@ func InitGR(nodes []*v1.Node, pods []*v1.Pod, collected bool) *GloalReserve {
 }
 
 // InitHTTPServer creates GlobalReserve http server for UT
-func InitHTTPServer(gr *GloalReserve) *http.Server {
-	// start the http server to receive 3rd party reserve request
-	router := httprouter.New()
-	router.POST(ReserveHTTPPathPrefix, AddReserveRoute(gr))
-	router.POST(UnreserveHTTPPathPrefix, AddUnreserveRoute(gr))
-
-	server := &http.Server{Addr: ":23456", Handler: router}
-
-	go func() {
-		server.ListenAndServe()
-	}()
-
-	return server
+func InitHTTPServer(gr *GloalReserve) (*ReserveServer, error) {
+	// listen on a random port, so the tests can run several servers
+	return StartHTTPServer(gr, "127.0.0.1:0", nil)
 }
 
 // GetResIDMap return a map between resource type and index for UT
@@ -224,3 +212,24 @@ func GetPod(name string, cpuStr string, memStr string, nodename string, sta v1.P
 		},
 	}
 }
+
+// GetGuaranteedPod returns a pod with Guaranteed QoS
+func GetGuaranteedPod(name string, cpuStr string, memStr string, nodename string) *v1.Pod {
+	pod := GetPod(name, cpuStr, memStr, nodename, v1.PodPending)
+	for i := range pod.Spec.Containers {
+		pod.Spec.Containers[i].Resources.Limits = pod.Spec.Containers[i].Resources.Requests.DeepCopy()
+	}
+	return pod
+}
+
+// GetZonedNode returns a node with 2 NUMA zones for UT
+func GetZonedNode() *v1.Node {
+	node := GetNode0()
+	node.Name = "zoned"
+	node.UID = "zoned"
+	node.Status.Allocatable[v1.ResourceCPU] = *(resource.NewQuantity(4, resource.DecimalSI))
+	node.Annotations = map[string]string{
+		NUMAZonesAnnotation: `{"zone0": {"cpu": "2", "memory": "2500"}, "zone1": {"cpu": "2", "memory": "2500"}}`,
+	}
+	return node
+}
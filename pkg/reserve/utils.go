@@ -19,18 +19,52 @@ package reserve
 import (
 	v1 "k8s.io/api/core/v1"
 	v1resource "k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
 	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
 )
 
 // ResourceTypeBuffer is used for adding new resource types
 const ResourceTypeBuffer int = 3
 
+// DefaultListeningPort is the default http server listening port
+const DefaultListeningPort string = "23456"
+
 // ReserveHTTPPathPrefix reserve url prefix
 const ReserveHTTPPathPrefix string = "/reserve"
 
 // UnreserveHTTPPathPrefix unreserve url prefix
 const UnreserveHTTPPathPrefix string = "/unreserve"
 
+// NodesHTTPPathPrefix node query url prefix
+const NodesHTTPPathPrefix string = "/nodes"
+
+// BookingsHTTPPathPrefix booking url prefix
+const BookingsHTTPPathPrefix string = "/bookings"
+
+// PlaceholdersHTTPPathPrefix placeholder url prefix
+const PlaceholdersHTTPPathPrefix string = "/placeholders"
+
+// PlaceHTTPPathPrefix placement url prefix
+const PlaceHTTPPathPrefix string = "/place"
+
+// FeasibleHTTPPathPrefix feasible nodes query url prefix
+const FeasibleHTTPPathPrefix string = "/feasible"
+
+// VerifyHTTPPathPrefix reservation verifying url prefix
+const VerifyHTTPPathPrefix string = "/verify"
+
+// ConfirmHTTPPathPrefix binding confirmation url prefix
+const ConfirmHTTPPathPrefix string = "/confirm"
+
+// ReconcileHTTPPathPrefix on-demand reconciliation url prefix
+const ReconcileHTTPPathPrefix string = "/reconcile"
+
+// ReleaseHTTPPathPrefix release url prefix
+const ReleaseHTTPPathPrefix string = "/release"
+
+// MetricsHTTPPathPrefix prometheus metrics url prefix
+const MetricsHTTPPathPrefix string = "/metrics"
+
 // ReserveSchedulerName defines the empty scheduler name
 const ReserveSchedulerName string = "schedulername_is_empty"
 
@@ -41,12 +75,51 @@ type PodsReserveRequest struct {
 	Pods          []*v1.Pod
 	Nodes         []string
 	SchedulerName string
+	Claims        []string    `json:",omitempty"` // optional claim tokens of the pods, overriding ClaimAnnotation
+	UIDs          []types.UID `json:",omitempty"` // pods only unreserved by UID, their nodes are found in the cache
 }
 
 // PodReserveResult reserve http return data struct
 type PodReserveResult struct {
 	FailedPods []string
 	Error      string
+	Reason     ErrorReason       `json:",omitempty"` // reason of Error
+	Zones      map[string]string `json:",omitempty"` // key: pod namespace/name, value: the reserved NUMA zone
+	Results    []PodResult       `json:",omitempty"` // result of every pod in the request order
+}
+
+// PodResult is the result of one pod in a batch
+type PodResult struct {
+	Pod    string // namespace/name
+	UID    types.UID
+	Node   string
+	Zone   string      `json:",omitempty"` // the reserved NUMA zone
+	Reason ErrorReason `json:",omitempty"`
+	Error  string      `json:",omitempty"`
+}
+
+// Err returns the typed error of the pod, nil if it succeeded
+func (r *PodResult) Err() error {
+	return errorFromResult(r.Reason, r.Error)
+}
+
+// FeasibleResult feasible nodes http return data struct
+type FeasibleResult struct {
+	Nodes []string
+	Error string
+}
+
+// NodeResourceStatus node query http return data struct
+type NodeResourceStatus struct {
+	Name              string
+	Pool              string          `json:",omitempty"`
+	Capacity          v1.ResourceList // capacity reported by the node
+	EffectiveCapacity v1.ResourceList // capacity after overcommit
+	Available         v1.ResourceList // available for the pods not using the emergency resources
+	Requested         v1.ResourceList // requested by the bound pods
+	Reserved          v1.ResourceList // reserved by the pods not bound yet
+	Headroom          v1.ResourceList // never reserved
+	Emergency         v1.ResourceList // only reserved by high priority pods
 }
 
 // QuantityToInt translate k8s resource quantity into an integer
@@ -64,6 +137,36 @@ func QuantityToInt(name v1.ResourceName, res v1resource.Quantity) int64 {
 	return ret
 }
 
+// IntToQuantity translates an integer created by QuantityToInt back into a k8s resource quantity
+func IntToQuantity(name v1.ResourceName, value int64) v1resource.Quantity {
+	if !v1helper.IsExtendedResourceName(name) {
+		switch name {
+		case v1.ResourceCPU:
+			return *v1resource.NewMilliQuantity(value, v1resource.DecimalSI)
+		case v1.ResourceMemory, v1.ResourceEphemeralStorage:
+			return *v1resource.NewQuantity(value, v1resource.BinarySI)
+		}
+	}
+	return *v1resource.NewQuantity(value, v1resource.DecimalSI)
+}
+
+// VectorToResourceList translates a resource vector back into a resource list
+func VectorToResourceList(vec []int64, resIDMap map[v1.ResourceName]int) v1.ResourceList {
+	list := v1.ResourceList{}
+	for resName, resIndex := range resIDMap {
+		if resIndex < len(vec) {
+			list[resName] = IntToQuantity(resName, vec[resIndex])
+		}
+	}
+	return list
+}
+
+// PodKey returns namespace/name of the pod, which identifies the pod in the results, errors and logs
+// together with its UID
+func PodKey(pod *v1.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
 // assignedPod selects pods that are assigned (scheduled and running).
 func assignedPod(pod *v1.Pod) bool {
 	return len(pod.Spec.NodeName) != 0
@@ -84,6 +187,28 @@ func VectorCompare(a []int64, b []int64) bool {
 	return true
 }
 
+// VectorEqual returns true if a and b have the same values
+func VectorEqual(a []int64, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i, v := range b {
+		if v != a[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// VectorAdd a plus b
+func VectorAdd(a []int64, b []int64) {
+	for i, v := range b {
+		a[i] = a[i] + v
+	}
+}
+
 // VectorMinus a minus b
 func VectorMinus(a []int64, b []int64) {
 	for i, v := range b {
@@ -0,0 +1,136 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"encoding/json"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+	v1qos "k8s.io/kubernetes/pkg/apis/core/v1/helper/qos"
+)
+
+// NUMAZonesAnnotation is the node annotation describing the per NUMA zone capacity, the value is
+// a json map, key is the zone name and value is a resource list, e.g.
+// {"node-0": {"cpu": "16", "memory": "64Gi"}, "node-1": {"cpu": "16", "memory": "64Gi"}}
+const NUMAZonesAnnotation string = "globalreserve.ibm.com/numa-zones"
+
+// ZoneResInfo saves the capacity of one NUMA zone in NodeResInfo.Zones
+type ZoneResInfo struct {
+	Name string
+	Capa resVector
+}
+
+// GetNodeZones parses the NUMA zones of a node from NUMAZonesAnnotation, returns nil if the node
+// does not have the annotation
+func GetNodeZones(node *v1.Node) map[string]v1.ResourceList {
+	value, ok := node.Annotations[NUMAZonesAnnotation]
+	if !ok || len(value) == 0 {
+		return nil
+	}
+
+	zones := make(map[string]v1.ResourceList)
+	if err := json.Unmarshal([]byte(value), &zones); err != nil {
+		klog.Errorf("Node %s has an invalid %s annotation: %s", node.Name, NUMAZonesAnnotation, err.Error())
+		return nil
+	}
+
+	return zones
+}
+
+// NeedZoneAlignment returns true if the pod must be placed in a single NUMA zone, it is true for
+// Guaranteed pods requesting integer cpus which get exclusive cpus from the static CPU manager
+func NeedZoneAlignment(pod *v1.Pod) bool {
+	if v1qos.GetPodQOS(pod) != v1.PodQOSGuaranteed {
+		return false
+	}
+
+	for _, container := range pod.Spec.Containers {
+		cpu, ok := container.Resources.Requests[v1.ResourceCPU]
+		if !ok || cpu.MilliValue()%1000 != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SetZones replaces the NUMA zones of this NodeResInfo, the resources not described by a zone are
+// limited by the node capacity only. Passing an empty map removes the zones.
+func (nr *NodeResInfo) SetZones(zones map[string]v1.ResourceList, resIDMap map[v1.ResourceName]int) {
+	nr.Zones = nil
+	for zoneName, zoneRes := range zones {
+		resources := make([]int64, len(nr.Capa))
+		copy(resources, nr.Capa)
+		for resName, resValue := range zoneRes {
+			resIndex, ok := resIDMap[resName]
+			if !ok {
+				klog.Warningf("Zone %s on node %s has an unknown resource %s, ignore it.", zoneName, nr.Name, resName)
+				continue
+			}
+			resources[resIndex] = QuantityToInt(resName, resValue)
+		}
+
+		nr.Zones = append(nr.Zones, &ZoneResInfo{
+			Name: zoneName,
+			Capa: resources,
+		})
+	}
+
+	// zones are always checked in the same order
+	sort.Slice(nr.Zones, func(i, j int) bool {
+		return nr.Zones[i].Name < nr.Zones[j].Name
+	})
+}
+
+// GetZoneAvailable caculates the free resources of every zone, key is the zone name
+func (nr *NodeResInfo) GetZoneAvailable() map[string]resVector {
+	zoneAvai := make(map[string]resVector, len(nr.Zones))
+	for _, zone := range nr.Zones {
+		avaiRes := make([]int64, len(zone.Capa))
+		copy(avaiRes, zone.Capa)
+		zoneAvai[zone.Name] = avaiRes
+	}
+
+	for _, pod := range nr.Pods {
+		if len(pod.Zone) == 0 || pod.Status == v1.PodSucceeded || pod.Status == v1.PodFailed {
+			continue
+		}
+		if avaiRes, ok := zoneAvai[pod.Zone]; ok {
+			VectorMinus(avaiRes, pod.Resources)
+		}
+	}
+
+	return zoneAvai
+}
+
+// PickZone returns the first zone which can hold podReq, zoneAvai is the result of GetZoneAvailable.
+// The returned zone is empty if the node does not have zones, ok is false if no zone fits.
+func (nr *NodeResInfo) PickZone(zoneAvai map[string]resVector, podReq resVector) (zone string, ok bool) {
+	if len(nr.Zones) == 0 {
+		return "", true
+	}
+
+	for _, z := range nr.Zones {
+		if VectorCompare(zoneAvai[z.Name], podReq) {
+			return z.Name, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,131 @@
+//
+// Copyright 2020 IBM Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reserve
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestNewNodeResInfoZones(t *testing.T) {
+	riMap := GetResIDMap()
+
+	t.Run("NodeResInfo without zones", func(t *testing.T) {
+		ni := NewNodeResInfo(GetNode0(), riMap, len(riMap)+ResourceTypeBuffer)
+		if len(ni.Zones) != 0 {
+			t.Errorf("node without zones failed")
+		}
+	})
+
+	t.Run("NodeResInfo with zones", func(t *testing.T) {
+		ni := NewNodeResInfo(GetZonedNode(), riMap, len(riMap)+ResourceTypeBuffer)
+		if len(ni.Zones) != 2 || ni.Zones[0].Name != "zone0" || ni.Zones[1].Name != "zone1" ||
+			ni.Zones[0].Capa[0] != 2000 || ni.Zones[0].Capa[1] != 2500 || ni.Zones[0].Capa[2] != 10 {
+			t.Errorf("node with zones failed")
+		}
+	})
+}
+
+func TestNeedZoneAlignment(t *testing.T) {
+	t.Run("NeedZoneAlignment burstable pod", func(t *testing.T) {
+		if NeedZoneAlignment(GetPod("pod0", "1", "1000", "", v1.PodPending)) {
+			t.Errorf("burstable pod failed")
+		}
+	})
+
+	t.Run("NeedZoneAlignment guaranteed pod with fractional cpu", func(t *testing.T) {
+		if NeedZoneAlignment(GetGuaranteedPod("pod0", "500m", "1000", "")) {
+			t.Errorf("guaranteed pod with fractional cpu failed")
+		}
+	})
+
+	t.Run("NeedZoneAlignment guaranteed pod with integer cpu", func(t *testing.T) {
+		if !NeedZoneAlignment(GetGuaranteedPod("pod0", "1", "1000", "")) {
+			t.Errorf("guaranteed pod with integer cpu failed")
+		}
+	})
+}
+
+func TestReserveZone(t *testing.T) {
+	nodes := []*v1.Node{GetZonedNode()}
+	gr := InitGR(nodes, nil, true)
+
+	pod0 := GetGuaranteedPod("pod0", "2", "1000", "zoned")
+	pod1 := GetGuaranteedPod("pod1", "1", "1000", "zoned")
+	pod2 := GetGuaranteedPod("pod2", "2", "1000", "zoned")
+	pod3 := GetPod("pod3", "1", "1000", "zoned", v1.PodPending)
+
+	t.Run("Reserve zone success", func(t *testing.T) {
+		ret := gr.Reserve(pod0, "zoned")
+		if len(ret) > 0 || gr.PodZone(pod0.UID) != "zone0" {
+			t.Errorf("Reserve zone success failed")
+		}
+	})
+
+	t.Run("Reserve zone picks the next zone", func(t *testing.T) {
+		ret := gr.ReservePods([]*v1.Pod{pod1}, []string{"zoned"})
+		if len(ret.Error) > 0 || ret.Zones["NS1/pod1"] != "zone1" || gr.PodZone(pod1.UID) != "zone1" {
+			t.Errorf("Reserve zone picks the next zone failed")
+		}
+	})
+
+	t.Run("Reserve zone error", func(t *testing.T) {
+		// the node has 1 cpu left but no zone can hold 2 cpus
+		ret := gr.Reserve(pod2, "zoned")
+		if len(ret) == 0 || len(gr.NodeCache["zoned"].Pods) != 2 {
+			t.Errorf("Reserve zone error failed")
+		}
+	})
+
+	t.Run("Reserve non-aligned pod ignores zones", func(t *testing.T) {
+		ret := gr.Reserve(pod3, "zoned")
+		if len(ret) > 0 || gr.PodZone(pod3.UID) != "" {
+			t.Errorf("Reserve non-aligned pod failed")
+		}
+	})
+}
+
+func TestSetNodeZones(t *testing.T) {
+	gr := InitGR([]*v1.Node{GetNode0()}, nil, true)
+	gr.SetNodeZones("node0", map[string]v1.ResourceList{
+		"zone0": {v1.ResourceCPU: resource.MustParse("1")},
+		"zone1": {v1.ResourceCPU: resource.MustParse("1")},
+	})
+
+	t.Run("SetNodeZones kept by node update", func(t *testing.T) {
+		oldNode := GetNode0()
+		newNode := GetNode0()
+		newNode.Labels = map[string]string{"pool": "dev"}
+		gr.UpdateNode(oldNode, newNode)
+		zones := gr.NodeCache["node0"].Zones
+		if len(zones) != 2 || zones[0].Name != "zone0" || zones[0].Capa[gr.ResTypeToID[v1.ResourceCPU]] != 1000 {
+			t.Errorf("kept by node update failed: %v", zones)
+		}
+	})
+
+	t.Run("SetNodeZones replaced by annotation", func(t *testing.T) {
+		newNode := GetNode0()
+		newNode.Annotations = map[string]string{NUMAZonesAnnotation: `{"numa0": {"cpu": "2"}}`}
+		gr.UpdateNode(GetNode0(), newNode)
+		zones := gr.NodeCache["node0"].Zones
+		if len(zones) != 1 || zones[0].Name != "numa0" {
+			t.Errorf("replaced by annotation failed: %v", zones)
+		}
+	})
+}